@@ -0,0 +1,254 @@
+package funcserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Adapter converts between a provider's events and net/http. An adapter decodes an incoming event of type Req into a
+// *http.Request and encodes the response recorded for that request into a response event of type Resp. Adapters only
+// deal with the event format, Wrap takes care of calling the http.Handler.
+type Adapter[Req, Resp any] interface {
+	// DecodeRequest converts an incoming event into a *http.Request.
+	DecodeRequest(ctx context.Context, event Req) (*http.Request, error)
+
+	// EncodeResponse converts the response recorded for req into a response event.
+	EncodeResponse(req *http.Request, res RecordedResponse) (Resp, error)
+}
+
+// Options holds the options for WrapWithOptions, the adapter packages' options embed it.
+type Options struct {
+	// RecoverPanics turns a panic in the handler into a 500 response (see PanicHandler), by default the invocation
+	// fails with the panic as the error.
+	RecoverPanics bool
+
+	// PanicHandler writes the response for a recovered panic, the default is a plain text 500 Internal Server Error.
+	// The response the handler was writing when it panicked is discarded.
+	PanicHandler http.Handler
+
+	// PanicReporter is called with the error & stack trace of every panic (other than http.ErrAbortHandler), the
+	// default logs them as http.Server does.
+	PanicReporter func(req *http.Request, err error, stack []byte)
+
+	// RespondToBadRequests answers a request that can't be decoded because of the client's input (a *RequestError)
+	// with a response written by ErrorHandler, by default the invocation fails with the error which lambda reports to
+	// the client as a 502.
+	RespondToBadRequests bool
+
+	// ErrorHandler writes the response to a bad request (see RespondToBadRequests) and the errors returned by
+	// HTTPHandlerFuncs, the default is WriteError.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+	// TimeoutMargin, if set, answers a request before lambda kills the invocation for running past its deadline (the
+	// client would get a 502). When only TimeoutMargin is left the request's context is cancelled and the response
+	// written by TimeoutHandler is sent, as with http.TimeoutHandler the handler's writes after that fail with
+	// http.ErrHandlerTimeout. The handler is run in its own goroutine.
+	TimeoutMargin time.Duration
+
+	// TimeoutHandler writes the response to a request that timed out (see TimeoutMargin), the default is a plain text
+	// 503 Service Unavailable. Use a 504 Gateway Timeout if the handler was waiting on an upstream service.
+	TimeoutHandler http.Handler
+
+	// LateWriteReporter is called when the response to req is written after it was finalised, usually by a goroutine
+	// the handler started that's still running after ServeHTTP returned. The write fails with ErrResponseFinalised.
+	// It's called once per request, the default logs the request.
+	LateWriteReporter func(req *http.Request)
+
+	// MaxConcurrency limits the number of requests the handler serves at once, 0 is unlimited. Lambda can run several
+	// invocations at once in one execution environment (lambdaruntime handles up to AWS_LAMBDA_MAX_CONCURRENCY at
+	// once, see lambdaruntime.Client.Concurrency), the limit applies to all of them as long as they share the wrapped
+	// handler. A request waits for its turn until its context is done (TimeoutMargin before the deadline if
+	// it's set), then it's answered by TimeoutHandler. A handler that timed out keeps its slot until it returns.
+	MaxConcurrency int
+
+	// OnColdStart are called, in order, before the wrapped handler handles its first invocation, eg to warm caches.
+	// Invocations that arrive while they're running wait for them. The context is the first invocation's, see
+	// InvocationFromContext.
+	OnColdStart []func(ctx context.Context)
+}
+
+// Wrap returns a Handler that uses a to convert events to and from requests and responses for h. The response is
+// recorded with a ResponseRecorder, a panic in h is returned as an error (see Options.RecoverPanics).
+func Wrap[Req, Resp any](a Adapter[Req, Resp], h http.Handler) Handler[Req, Resp] {
+	return WrapWithOptions(a, h, Options{})
+}
+
+// WrapWithOptions is the same as Wrap but with options, see Options.
+func WrapWithOptions[Req, Resp any](a Adapter[Req, Resp], h http.Handler, opts Options) Handler[Req, Resp] {
+	var sem chan struct{}
+	if opts.MaxConcurrency > 0 {
+		sem = make(chan struct{}, opts.MaxConcurrency)
+	}
+
+	iv := &invoker{opts: opts}
+
+	return func(ctx context.Context, event Req) (resp Resp, err error) {
+		ctx = iv.start(ctx)
+
+		req, badRequest, err := iv.request(a.DecodeRequest(ctx, event))
+		if err != nil {
+			return resp, err
+		}
+		if badRequest != nil {
+			return respond(a, req, badRequest)
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				err = iv.recovered(req, r)
+				if opts.RecoverPanics {
+					resp, err = respond(a, req, iv.panicHandler())
+				}
+			}
+		}()
+
+		release := func() {}
+		if sem != nil {
+			if !acquire(ctx, sem, opts) {
+				return timeoutResponse(a, req, opts)
+			}
+			// the slot is freed when h returns, a timed out handler keeps it
+			release = func() { <-sem }
+		}
+
+		rec := NewResponseRecorder()
+		rec.lateWrite = func() { opts.reportLateWrite(req) }
+
+		if deadline, ok := ctx.Deadline(); ok && opts.TimeoutMargin > 0 {
+			reportPanic := func(p handlerPanic) { _ = iv.recovered(req, p) }
+			if timedOut := serveWithTimeout(h, rec, req, deadline.Add(-opts.TimeoutMargin), release, reportPanic); timedOut {
+				return timeoutResponse(a, req, opts)
+			}
+			return a.EncodeResponse(req, rec.Result())
+		}
+
+		defer release()
+		h.ServeHTTP(rec, req)
+
+		return a.EncodeResponse(req, rec.Result())
+	}
+}
+
+// PanicError converts a value recovered from a panic into an error, an error value is wrapped so that the original
+// error is available via errors.Cause.
+func PanicError(r interface{}) error {
+	switch e := r.(type) {
+	case error:
+		return errors.Wrap(e, "panic")
+	case string:
+		return errors.New(e)
+	default:
+		return errors.Errorf("panic: %v", e)
+	}
+}
+
+func (opts Options) reportPanic(req *http.Request, err error, stack []byte) {
+	if opts.PanicReporter != nil {
+		opts.PanicReporter(req, err, stack)
+		return
+	}
+	log.Printf("funcserver: panic serving %s %s: %v\n%s", req.Method, req.URL.Path, err, stack)
+}
+
+func (opts Options) reportLateWrite(req *http.Request) {
+	if opts.LateWriteReporter != nil {
+		opts.LateWriteReporter(req)
+		return
+	}
+	log.Printf("funcserver: write after the response was finalised serving %s %s", req.Method, req.URL.Path)
+}
+
+// acquire takes a slot in sem, it returns false if ctx is done (or TimeoutMargin before its deadline) first.
+func acquire(ctx context.Context, sem chan struct{}, opts Options) bool {
+	if deadline, ok := ctx.Deadline(); ok && opts.TimeoutMargin > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-opts.TimeoutMargin))
+		defer cancel()
+	}
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// invoker runs the steps of an invocation that are the same whether the response is recorded (WrapWithOptions) or
+// streamed (WrapStreaming).
+type invoker struct {
+	opts      Options
+	coldStart sync.Once
+}
+
+// start returns ctx with the invocation being handled (see InvocationFromContext), the OnColdStart hooks are run before
+// the first invocation is handled.
+func (iv *invoker) start(ctx context.Context) context.Context {
+	ctx = withColdStart(ctx)
+	iv.coldStart.Do(func() {
+		for _, f := range iv.opts.OnColdStart {
+			f(ctx)
+		}
+	})
+	return ctx
+}
+
+// request returns the decoded request to serve, with the ErrorHandler in its context. A bad request that's answered
+// (see RespondToBadRequests) is returned with badRequest, the handler that writes the response, otherwise err is
+// returned as is.
+func (iv *invoker) request(req *http.Request, err error) (_ *http.Request, badRequest http.Handler, _ error) {
+	if err != nil {
+		reqErr, ok := as[*RequestError](err)
+		if !ok || reqErr.Request == nil || !iv.opts.RespondToBadRequests {
+			return nil, nil, err
+		}
+		eh := iv.opts.ErrorHandler
+		if eh == nil {
+			eh = WriteError
+		}
+		req = reqErr.Request
+		badRequest = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			eh(w, r, reqErr)
+		})
+	}
+	if iv.opts.ErrorHandler != nil {
+		req = req.WithContext(withErrorHandler(req.Context(), iv.opts.ErrorHandler))
+	}
+	return req, badRequest, nil
+}
+
+// recovered reports r, recovered from a panic serving req, & returns it as an error. It must be called by the deferred
+// function for the stack to be the panic's.
+func (iv *invoker) recovered(req *http.Request, r interface{}) error {
+	stack := debug.Stack()
+	if p, ok := r.(handlerPanic); ok {
+		r, stack = p.value, p.stack
+	}
+	err := PanicError(r)
+	if r != http.ErrAbortHandler {
+		iv.opts.reportPanic(req, err, stack)
+	}
+	return err
+}
+
+// panicHandler returns the handler that writes the response to a request whose handler panicked, see PanicHandler.
+func (iv *invoker) panicHandler() http.Handler {
+	if iv.opts.PanicHandler != nil {
+		return iv.opts.PanicHandler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	})
+}
+
+// respond records the response of h to req and encodes it.
+func respond[Req, Resp any](a Adapter[Req, Resp], req *http.Request, h http.Handler) (Resp, error) {
+	rec := NewResponseRecorder()
+	h.ServeHTTP(rec, req)
+	return a.EncodeResponse(req, rec.Result())
+}
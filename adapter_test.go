@@ -0,0 +1,400 @@
+package funcserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type testAdapter struct{}
+
+func (testAdapter) DecodeRequest(ctx context.Context, e testEvent) (*http.Request, error) {
+	req, err := e.AsHTTPRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if e.Path == "/bad" {
+		return nil, &RequestError{Request: req, Err: errors.New("bad input")}
+	}
+	return req, err
+}
+
+func (testAdapter) EncodeResponse(req *http.Request, res RecordedResponse) (testResponse, error) {
+	return testResponse{Body: res.Header.Get("Content-Type") + " " + string(res.Body)}, nil
+}
+
+func TestWrap(t *testing.T) {
+	t.Run("response", func(t *testing.T) {
+		h := Wrap[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte("path " + req.URL.Path))
+		}))
+
+		resp, err := h(context.Background(), testEvent{Path: "/a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "text/plain; charset=utf-8 path /a" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 path /a")
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		h := Wrap[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			panic("oops")
+		}))
+
+		if _, err := h(context.Background(), testEvent{Path: "/a"}); err == nil || err.Error() != "oops" {
+			t.Errorf(`err = %v, want: %q`, err, "oops")
+		}
+	})
+
+	t.Run("panic error", func(t *testing.T) {
+		panicErr := errors.New("oops")
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			panic(panicErr)
+		}), Options{PanicReporter: func(req *http.Request, err error, stack []byte) {}})
+
+		if _, err := h(context.Background(), testEvent{Path: "/a"}); errors.Cause(err) != panicErr {
+			t.Errorf(`errors.Cause(err) = %v, want: %v`, errors.Cause(err), panicErr)
+		}
+	})
+
+	t.Run("recover panics", func(t *testing.T) {
+		var reported error
+		var stack []byte
+		opts := Options{
+			RecoverPanics: true,
+			PanicReporter: func(req *http.Request, err error, s []byte) {
+				reported, stack = err, s
+			},
+		}
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte("partial"))
+			panic(errors.New("oops"))
+		}), opts)
+
+		resp, err := h(context.Background(), testEvent{Path: "/a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "text/plain; charset=utf-8 Internal Server Error\n" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 Internal Server Error\n")
+		}
+		if reported == nil || !bytes.Contains(stack, []byte("adapter_test.go")) {
+			t.Errorf(`reported = %v, stack = %s, want: error & stack`, reported, stack)
+		}
+
+		opts.PanicHandler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusInternalServerError)
+			_, _ = res.Write([]byte(`{"error":"internal"}`))
+		})
+		h = WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			panic("oops")
+		}), opts)
+		resp, err = h(context.Background(), testEvent{Path: "/a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != `application/json {"error":"internal"}` {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, `application/json {"error":"internal"}`)
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			t.Error("handler called for a bad request")
+		})
+
+		_, err := Wrap[testEvent, testResponse](testAdapter{}, handler)(context.Background(), testEvent{Path: "/bad"})
+		if _, ok := errors.Cause(err).(*RequestError); !ok {
+			t.Errorf(`err = %#v, want: *RequestError`, err)
+		}
+
+		opts := Options{RespondToBadRequests: true}
+		resp, err := WrapWithOptions[testEvent, testResponse](testAdapter{}, handler, opts)(context.Background(), testEvent{Path: "/bad"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "text/plain; charset=utf-8 Bad Request\n" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 Bad Request\n")
+		}
+
+		opts.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"` + err.Error() + `"}`))
+		}
+		resp, err = WrapWithOptions[testEvent, testResponse](testAdapter{}, handler, opts)(context.Background(), testEvent{Path: "/bad"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != `application/json {"error":"invalid request: bad input"}` {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, `application/json {"error":"invalid request: bad input"}`)
+		}
+	})
+}
+
+func TestResponseRecorder(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		res := NewResponseRecorder().Result()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf(`res.StatusCode = %d, want: %d`, res.StatusCode, http.StatusOK)
+		}
+		if res.Header.Get("Content-Type") != "" {
+			t.Errorf(`Content-Type = %q, want: %q`, res.Header.Get("Content-Type"), "")
+		}
+	})
+
+	t.Run("header changes after WriteHeader ignored", func(t *testing.T) {
+		rec := NewResponseRecorder()
+		rec.Header().Set("X-Before", "1")
+		rec.WriteHeader(http.StatusCreated)
+		rec.Header().Set("X-After", "1")
+		_, _ = rec.Write([]byte(`{}`))
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusCreated {
+			t.Errorf(`res.StatusCode = %d, want: %d`, res.StatusCode, http.StatusCreated)
+		}
+		if res.Header.Get("X-Before") != "1" {
+			t.Errorf(`X-Before = %q, want: %q`, res.Header.Get("X-Before"), "1")
+		}
+		if res.Header.Get("X-After") != "" {
+			t.Errorf(`X-After = %q, want: %q`, res.Header.Get("X-After"), "")
+		}
+		if string(res.Body) != `{}` {
+			t.Errorf(`res.Body = %q, want: %q`, res.Body, `{}`)
+		}
+	})
+	t.Run("informational responses ignored", func(t *testing.T) {
+		rec := NewResponseRecorder()
+		rec.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		rec.WriteHeader(http.StatusEarlyHints)
+		rec.WriteHeader(http.StatusAccepted)
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusAccepted {
+			t.Errorf(`res.StatusCode = %d, want: %d`, res.StatusCode, http.StatusAccepted)
+		}
+		if res.Header.Get("Link") == "" {
+			t.Error("Link header of the early hints missing")
+		}
+	})
+
+	t.Run("switching protocols ignored", func(t *testing.T) {
+		rec := NewResponseRecorder()
+		rec.WriteHeader(http.StatusSwitchingProtocols)
+		_, _ = rec.Write([]byte("body"))
+
+		res := rec.Result()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf(`res.StatusCode = %d, want: %d`, res.StatusCode, http.StatusOK)
+		}
+	})
+
+	t.Run("trailers merged", func(t *testing.T) {
+		rec := NewResponseRecorder()
+		rec.Header().Set("Trailer", "X-Checksum")
+		_, _ = rec.Write([]byte("body"))
+		rec.Header().Set("X-Checksum", "abc")
+		rec.Header().Set(http.TrailerPrefix+"X-Count", "1")
+
+		res := rec.Result()
+		for k, want := range map[string]string{"X-Checksum": "abc", "X-Count": "1", "Trailer": ""} {
+			if res.Header.Get(k) != want {
+				t.Errorf(`%s = %q, want: %q`, k, res.Header.Get(k), want)
+			}
+		}
+	})
+
+	t.Run("optional interfaces", func(t *testing.T) {
+		rec := NewResponseRecorder()
+		rc := http.NewResponseController(rec)
+
+		if err := rc.Flush(); err != nil {
+			t.Errorf(`Flush() = %v, want: nil`, err)
+		}
+		if _, err := io.Copy(rec, strings.NewReader("copied")); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.SetWriteDeadline(time.Now()); err != http.ErrNotSupported {
+			t.Errorf(`SetWriteDeadline() = %v, want: %v`, err, http.ErrNotSupported)
+		}
+		if _, _, err := rc.Hijack(); err != http.ErrNotSupported {
+			t.Errorf(`Hijack() = %v, want: %v`, err, http.ErrNotSupported)
+		}
+		if err := rc.EnableFullDuplex(); err != http.ErrNotSupported {
+			t.Errorf(`EnableFullDuplex() = %v, want: %v`, err, http.ErrNotSupported)
+		}
+
+		if res := rec.Result(); res.StatusCode != http.StatusOK || string(res.Body) != "copied" {
+			t.Errorf(`res = %d %q, want: %d %q`, res.StatusCode, res.Body, http.StatusOK, "copied")
+		}
+	})
+
+	t.Run("body not allowed", func(t *testing.T) {
+		rec := NewResponseRecorder()
+		rec.WriteHeader(http.StatusNoContent)
+		if _, err := rec.Write([]byte("x")); err != http.ErrBodyNotAllowed {
+			t.Errorf(`Write() = %v, want: %v`, err, http.ErrBodyNotAllowed)
+		}
+	})
+}
+
+func TestWrapConcurrent(t *testing.T) {
+	t.Run("invocations", func(t *testing.T) {
+		h := Wrap[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("X-Path", req.URL.Path)
+			_, _ = res.Write([]byte(req.URL.Path))
+		}))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+				resp, err := h(context.Background(), testEvent{Path: path})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if want := "text/plain; charset=utf-8 " + path; resp.Body != want {
+					t.Errorf(`resp.Body = %q, want: %q`, resp.Body, want)
+				}
+			}(fmt.Sprintf("/%d", i))
+		}
+		wg.Wait()
+	})
+
+	t.Run("late write", func(t *testing.T) {
+		reported := make(chan string, 1)
+		lateWrite := make(chan error, 1)
+		opts := Options{LateWriteReporter: func(req *http.Request) { reported <- req.URL.Path }}
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte("in time"))
+			go func() {
+				// writes until the response is finalised
+				for {
+					if _, err := res.Write([]byte(" late")); err != nil {
+						lateWrite <- err
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		}), opts)
+
+		if _, err := h(context.Background(), testEvent{Path: "/a"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-lateWrite; err != ErrResponseFinalised {
+			t.Errorf(`late Write() = %v, want: %v`, err, ErrResponseFinalised)
+		}
+		if path := <-reported; path != "/a" {
+			t.Errorf(`reported = %q, want: %q`, path, "/a")
+		}
+	})
+
+	t.Run("max concurrency", func(t *testing.T) {
+		const limit = 3
+		var inFlight, maxInFlight int32
+		release := make(chan struct{})
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				m := atomic.LoadInt32(&maxInFlight)
+				if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+					break
+				}
+			}
+			<-release
+		}), Options{MaxConcurrency: limit})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := h(context.Background(), testEvent{Path: "/a"}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		for atomic.LoadInt32(&inFlight) < limit {
+			time.Sleep(time.Millisecond)
+		}
+
+		// the slots are taken, a request that can't wait is answered with a 503
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		resp, err := h(ctx, testEvent{Path: "/b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "text/plain; charset=utf-8 Service Unavailable\n" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 Service Unavailable\n")
+		}
+
+		close(release)
+		wg.Wait()
+		if maxInFlight != limit {
+			t.Errorf(`maxInFlight = %d, want: %d`, maxInFlight, limit)
+		}
+	})
+
+	t.Run("max concurrency after a timeout", func(t *testing.T) {
+		var inFlight int32
+		release := make(chan struct{})
+		returned := make(chan struct{})
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if n := atomic.AddInt32(&inFlight, 1); n > 1 {
+				t.Errorf(`inFlight = %d, want: %d`, n, 1)
+			}
+			defer atomic.AddInt32(&inFlight, -1)
+			if req.URL.Path == "/slow" {
+				<-release
+				defer close(returned)
+			}
+		}), Options{MaxConcurrency: 1, TimeoutMargin: 10 * time.Millisecond})
+
+		invoke := func(path string) string {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+			defer cancel()
+			resp, err := h(ctx, testEvent{Path: path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return resp.Body
+		}
+
+		const unavailable = "text/plain; charset=utf-8 Service Unavailable\n"
+		if body := invoke("/slow"); body != unavailable {
+			t.Errorf(`resp.Body = %q, want: %q`, body, unavailable)
+		}
+		// the timed out handler is still running, it keeps the slot
+		if body := invoke("/a"); body != unavailable {
+			t.Errorf(`resp.Body = %q, want: %q`, body, unavailable)
+		}
+
+		close(release)
+		<-returned
+		for atomic.LoadInt32(&inFlight) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if body := invoke("/a"); body != " " {
+			t.Errorf(`resp.Body = %q, want: %q`, body, " ")
+		}
+	})
+}
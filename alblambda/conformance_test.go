@@ -0,0 +1,198 @@
+package alblambda
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The fixtures in testdata are the sample events & responses from the AWS documentation. The default Options are used,
+// the response must use the same (single or multi value) mode as the request.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html
+
+var conformanceModes = map[string]struct {
+	multiValue      bool
+	requestFixture  string
+	responseFixture string
+	responseHeaders string
+}{
+	"single value": {
+		requestFixture:  "request.json",
+		responseFixture: "response.json",
+		responseHeaders: "headers",
+	},
+	"multi value": {
+		multiValue:      true,
+		requestFixture:  "request_multi_value.json",
+		responseFixture: "response_multi_value.json",
+		responseHeaders: "multiValueHeaders",
+	},
+}
+
+func TestConformance(t *testing.T) { // nolint: gocyclo
+	for name, mode := range conformanceModes {
+		mode := mode
+		t.Run(name+" request", func(t *testing.T) {
+			event := readFixture(t, mode.requestFixture)
+
+			var called bool
+			h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				called = true
+				if req.Method != http.MethodGet {
+					t.Errorf(`req.Method = %q, want: %q`, req.Method, http.MethodGet)
+				}
+				if req.URL.Path != "/lambda" {
+					t.Errorf(`req.URL.Path = %q, want: %q`, req.URL.Path, "/lambda")
+				}
+				if req.URL.Query().Get("query") != "1234ABCD" {
+					t.Errorf(`req.URL.Query().Get("query") = %q, want: %q`, req.URL.Query().Get("query"), "1234ABCD")
+				}
+				if req.Header.Get("X-Forwarded-For") != "72.12.164.125" {
+					t.Errorf(`req.Header.Get("X-Forwarded-For") = %q, want: %q`, req.Header.Get("X-Forwarded-For"), "72.12.164.125")
+				}
+
+				// converting back gives the original event
+				albr, err := FromHTTPRequest(req, mode.multiValue)
+				if err != nil {
+					t.Fatal(err)
+				}
+				albr.RequestContext.ELB, _ = ELBFromContext(req.Context())
+				data, err := json.Marshal(albr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertJSONEqual(t, data, event)
+			})
+
+			if _, err := NewHandler(h, Options{}).Invoke(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+			if !called {
+				t.Error("handler not called")
+			}
+		})
+
+		t.Run(name+" response", func(t *testing.T) {
+			want := readFixture(t, mode.responseFixture)
+			var fixture Response
+			if err := json.Unmarshal(want, &fixture); err != nil {
+				t.Fatal(err)
+			}
+
+			h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				for k, v := range fixture.Headers {
+					res.Header().Add(k, v)
+				}
+				for k, vv := range fixture.MultiValueHeaders {
+					for _, v := range vv {
+						res.Header().Add(k, v)
+					}
+				}
+				res.WriteHeader(fixture.StatusCode)
+				_, _ = res.Write([]byte(fixture.Body))
+			})
+
+			got, err := NewHandler(h, Options{}).Invoke(context.Background(), readFixture(t, mode.requestFixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, got, canonicalResponseHeaders(t, want, mode.responseHeaders))
+		})
+	}
+
+	t.Run("single value cookies", func(t *testing.T) {
+		// the fixture sends a cookie as Set-cookie, with CookieCaseVariants further cookies are sent with other cases of
+		// the name
+		want := readFixture(t, "response.json")
+		var fixture Response
+		if err := json.Unmarshal(want, &fixture); err != nil {
+			t.Fatal(err)
+		}
+
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", fixture.Headers["Content-Type"])
+			res.Header().Add("Set-Cookie", fixture.Headers["Set-cookie"])
+			res.Header().Add("Set-Cookie", "more cookies")
+			_, _ = res.Write([]byte(fixture.Body))
+		})
+
+		got, err := NewHandler(h, Options{HeaderLoss: CookieCaseVariants}).Invoke(context.Background(), readFixture(t, "request.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp map[string]interface{}
+		if err := json.Unmarshal(canonicalResponseHeaders(t, want, "headers"), &resp); err != nil {
+			t.Fatal(err)
+		}
+		resp["headers"].(map[string]interface{})["set-Cookie"] = "more cookies"
+		data, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertJSONEqual(t, got, data)
+	})
+
+	t.Run("status description", func(t *testing.T) {
+		for code, want := range map[int]string{
+			http.StatusOK:                            "200 OK",
+			http.StatusNotFound:                      "404 Not Found",
+			http.StatusBadGateway:                    "502 Bad Gateway",
+			299:                                      "299 status code 299",
+			http.StatusNetworkAuthenticationRequired: "511 Network Authentication Required",
+		} {
+			h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(code)
+			})
+			resp := callHandlerReturnResp(t, h, Options{})
+			if resp.StatusDescription != want {
+				t.Errorf(`resp.StatusDescription = %q, want: %q`, resp.StatusDescription, want)
+			}
+		}
+	})
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// canonicalResponseHeaders canonicalises the header names in a response fixture (the docs use eg Set-cookie), header
+// names in responses are always canonical as they're set via http.Header.
+func canonicalResponseHeaders(t *testing.T, data []byte, field string) []byte {
+	var resp map[string]interface{}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	headers := make(map[string]interface{})
+	for k, v := range resp[field].(map[string]interface{}) {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	resp[field] = headers
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func assertJSONEqual(t *testing.T, got, want []byte) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("json = %s, want: %s", got, want)
+	}
+}
@@ -12,6 +12,10 @@ an appropriate response to the load balancer.
 Here's some background info
 https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html.
 
+The event types work in both directions, FromHTTPRequest and ResponseFromHTTP build events from their net/http
+equivalents (Request.AsHTTPRequest and Response.AsHTTPResponse go the other way), this is useful for tests, local
+proxies and replaying requests.
+
 Caveats:
 
 - request & response bodies are limited to 1mb in size (headers have separate size limits)
@@ -24,14 +28,15 @@ in private vpcs it can be ten+ seconds (being fixed in 2019 https://www.nuweba.c
 https://medium.freecodecamp.org/lambda-vpc-cold-starts-a-latency-killer-5408323278dd
 
 Example usage:
+
 	package main
 
 	import (
 		"net/http"
 
-		"github.com/aws/aws-lambda-go/lambda"
 		"github.com/gorilla/mux"
 		"github.com/j0hnsmith/funcserver/alblambda"
+		"github.com/j0hnsmith/funcserver/lambdaruntime"
 	)
 
 	func main() {
@@ -43,64 +48,157 @@ Example usage:
 		router.HandleFunc("/articles", func(resp http.ResponseWriter, req *http.Request) { resp.Write([]byte("<h1>Articles</h1>")) })
 
 		// wrap handler to automatically convert requests/responses
-		lambda.Start(alblambda.WrapHTTPHandler(router, alblambda.ResponseOptions{}))
+		lambdaruntime.StartHandler(alblambda.NewHandler(router, alblambda.Options{}))
 	}
-
 */
 package alblambda
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
+	"net/netip"
 
 	"github.com/j0hnsmith/funcserver"
-	"github.com/pkg/errors"
 )
 
+// Options holds the options for converting requests & responses.
+type Options struct {
+	funcserver.Options
+
+	// MultiValueHeaders forces responses to use multi value headers, it's the same as MultiValueMode: ForceMultiValue.
+	MultiValueHeaders bool
+
+	// MultiValueMode decides whether responses use multi value headers, by default a response uses the same mode as
+	// the request.
+	MultiValueMode MultiValueMode
+
+	// HeaderLoss decides what happens when response headers can't be sent without multi value headers, see
+	// HeaderLossPolicy. Repeated list headers are combined, only the first of repeated singleton & Set-Cookie headers
+	// is sent, use multi value headers to send several cookies, see MultiValueMode.
+	HeaderLoss HeaderLossPolicy
+
+	// ContentTypes decides which response bodies are binary & so base64 encoded.
+	ContentTypes funcserver.ContentClassifier
+
+	// TrustedProxies are the networks of any proxies in front of the load balancer (eg a CDN). The client address
+	// (http.Request.RemoteAddr) is the right most X-Forwarded-For address that isn't in one of these networks, the
+	// load balancer appends the address it received the request from so that's used if there are none.
+	TrustedProxies []netip.Prefix
+
+	// Overflow decides what happens to a response that's over the load balancer's limits, see OverflowStrategy.
+	Overflow OverflowStrategy
+
+	// OnOverflow returns the response to send instead of res, the response to req that's over the load balancer's
+	// limits, when Overflow is OverflowCallback. req is nil when there's no request, see ResponseFromHTTP.
+	OnOverflow func(req *http.Request, res funcserver.RecordedResponse) funcserver.RecordedResponse
+
+	// EagerInit builds the handler of WrapHTTPHandlerFunc & NewHandlerFunc straight away, during the function's init
+	// phase, rather than on the first invocation. A failed build is tried again on the first invocation.
+	EagerInit bool
+
+	// HealthCheck, if set, routes the load balancer's health checks away from the handler, see HealthCheck.
+	HealthCheck *HealthCheck
+}
+
+// ResponseOptions is the previous name of Options, kept for compatibility.
+type ResponseOptions = Options
+
+// MultiValueMode is whether multi value headers are used in responses. Multi value headers are a target group setting,
+// the load balancer returns a 502 if a response doesn't use the same mode as the target group.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html#multi-value-headers
+type MultiValueMode int
+
+const (
+	// AutoMultiValue uses multi value headers if the request had multi value headers or query params.
+	AutoMultiValue MultiValueMode = iota
+	// ForceSingleValue always uses single value headers.
+	ForceSingleValue
+	// ForceMultiValue always uses multi value headers.
+	ForceMultiValue
+)
+
+// multiValue reports whether the response to req uses multi value headers.
+func (opts Options) multiValue(req *http.Request) bool {
+	switch {
+	case opts.MultiValueHeaders || opts.MultiValueMode == ForceMultiValue:
+		return true
+	case opts.MultiValueMode == ForceSingleValue || req == nil:
+		return false
+	}
+	multiValue, _ := req.Context().Value(multiValueContextKey).(bool)
+	return multiValue
+}
+
 // WrapHTTPHandler is wrapper around a http.Handler to convert requests & responses for use in a AWS Lambda function
 // with requests coming from a ALB. Subject to a few caveats (max payload 1mb, no streaming requests/responses, possible
 // slow start delay), a vanilla http.Handler can be easily used with Lambda.
-func WrapHTTPHandler(h http.Handler, opts ResponseOptions) funcserver.RequestHandler {
-	return func(ctx context.Context, r map[string]interface{}) (resp interface{}, err error) {
-
-		// this is ugly and slow, it's done to meet the funcserver.RequestHandler interface and remove the
-		// need to export the type aLBRequest and everything that comes with it
-		data, err := json.Marshal(r)
-		if err != nil {
-			return
-		}
-		albr := new(aLBRequest)
-		err = json.Unmarshal(data, albr)
-		if err != nil {
-			return
-		}
-		// end uglyness
-
-		req, err := albr.AsHTTPRequest(ctx)
-		if err != nil {
-			return
-		}
-
-		res := newLambdaResponseWriter(opts)
-
-		defer func() {
-			if r := recover(); r != nil {
-				switch e := r.(type) {
-				case string:
-					err = errors.New(e)
-					return
-				default:
-					err = errors.New("panic: unknown cause")
-					return
-				}
-			}
-		}()
-
-		h.ServeHTTP(res, req)
-
-		// Response written, convert to alblambda format
-		resp = res.AsLambdaResponse()
-		return resp, err
+//
+// It's the untyped form of TypedHandler, NewHandler is faster as it decodes the payload straight into a Request.
+func WrapHTTPHandler(h http.Handler, opts Options) funcserver.RequestHandler {
+	return funcserver.Untyped(TypedHandler(h, opts))
+}
+
+// WrapHTTPHandlerFunc is the same as WrapHTTPHandler but the http.Handler is built by build on the first invocation
+// (or straight away, see Options.EagerInit). If build fails the invocation is answered with a 503 Service Unavailable
+// and the error is logged, see funcserver.LazyHandler.
+func WrapHTTPHandlerFunc(build func(ctx context.Context) (http.Handler, error), opts Options) funcserver.RequestHandler {
+	return WrapHTTPHandler(lazyHandler(build, opts), opts)
+}
+
+func lazyHandler(build func(ctx context.Context) (http.Handler, error), opts Options) http.Handler {
+	lh := funcserver.NewLazyHandler(build)
+	if opts.EagerInit {
+		// logged, tried again on the first invocation
+		_ = lh.Init(context.Background())
 	}
+	return lh
+}
+
+// TypedHandler is the same as WrapHTTPHandler but the handler receives a Request and returns a Response.
+func TypedHandler(h http.Handler, opts Options) funcserver.Handler[Request, Response] {
+	return withHealthCheck(funcserver.WrapWithOptions[Request, Response](NewAdapter(opts), h, opts.Options), opts)
+}
+
+// Handler converts requests & responses for a http.Handler, the same as WrapHTTPHandler, but it implements the
+// lambdaruntime.Handler (and aws-lambda-go lambda.Handler) interface. The raw payload is decoded once, straight into a
+// Request, which avoids the map -> json -> Request round trip WrapHTTPHandler has to make.
+//
+//	lambdaruntime.StartHandler(alblambda.NewHandler(router, alblambda.Options{}))
+type Handler struct {
+	handler funcserver.Handler[Request, Response]
+}
+
+// NewHandler returns a Handler for h.
+func NewHandler(h http.Handler, opts Options) *Handler {
+	return &Handler{handler: TypedHandler(h, opts)}
+}
+
+// NewHandlerFunc returns a Handler for the http.Handler built by build, see WrapHTTPHandlerFunc.
+func NewHandlerFunc(build func(ctx context.Context) (http.Handler, error), opts Options) *Handler {
+	return NewHandler(lazyHandler(build, opts), opts)
+}
+
+// Invoke decodes the payload, calls the http.Handler and returns the encoded response.
+func (h *Handler) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	return h.handler.Invoke(ctx, payload)
+}
+
+// Adapter converts ALB events to requests and responses to ALB events, it implements funcserver.Adapter.
+type Adapter struct {
+	opts Options
+}
+
+// NewAdapter returns an Adapter that converts requests & responses according to opts.
+func NewAdapter(opts Options) Adapter {
+	return Adapter{opts: opts}
+}
+
+// DecodeRequest converts albr to a *http.Request.
+func (a Adapter) DecodeRequest(ctx context.Context, albr Request) (*http.Request, error) {
+	return albr.asHTTPRequest(ctx, a.opts)
+}
+
+// EncodeResponse converts a recorded response to a Response.
+func (a Adapter) EncodeResponse(req *http.Request, res funcserver.RecordedResponse) (Response, error) {
+	return encodeResponse(req, res, a.opts, a.opts.multiValue(req))
 }
@@ -0,0 +1,230 @@
+package alblambda
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/j0hnsmith/funcserver"
+	"github.com/j0hnsmith/funcserver/lambdaruntime"
+)
+
+// benchmarkEvent is the example event from the AWS documentation.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html#receive-event-from-load-balancer
+var benchmarkEvent = []byte(`{
+    "requestContext": {
+        "elb": {
+            "targetGroupArn": "arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/lambda-279XGJDqGZ5rsrHC2Fjr/49e9d65c45c6791a"
+        }
+    },
+    "httpMethod": "GET",
+    "path": "/lambda",
+    "queryStringParameters": {
+        "query": "1234ABCD"
+    },
+    "headers": {
+        "accept": "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8",
+        "accept-encoding": "gzip",
+        "accept-language": "en-US,en;q=0.9",
+        "connection": "keep-alive",
+        "host": "lambda-alb-123578498.us-east-2.elb.amazonaws.com",
+        "upgrade-insecure-requests": "1",
+        "user-agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/71.0.3578.98 Safari/537.36",
+        "x-amzn-trace-id": "Root=1-5c536348-3d683b8b04734faae651f476",
+        "x-forwarded-for": "72.12.164.125",
+        "x-forwarded-port": "80",
+        "x-forwarded-proto": "http",
+        "x-imforwards": "20"
+    },
+    "body": "",
+    "isBase64Encoded": false
+}`)
+
+var benchmarkHandler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = res.Write([]byte("<h1>Hello World!</h1>"))
+})
+
+func TestHandlerInvoke(t *testing.T) {
+	t.Run("response", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/lambda" {
+				t.Errorf(`req.URL.Path = %q, want: %q`, req.URL.Path, "/lambda")
+			}
+			_, _ = res.Write([]byte("<h1>Hello World!</h1>"))
+		})
+
+		data, err := NewHandler(h, Options{}).Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var resp Response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusOK)
+		}
+		if resp.Body != "<h1>Hello World!</h1>" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "<h1>Hello World!</h1>")
+		}
+	})
+
+	t.Run("same response as WrapHTTPHandler", func(t *testing.T) {
+		fast, err := NewHandler(benchmarkHandler, Options{}).Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slow, err := lambdaruntime.NewHandler(WrapHTTPHandler(benchmarkHandler, Options{})).Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(fast) != string(slow) {
+			t.Errorf("Invoke() = %s, want: %s", fast, slow)
+		}
+	})
+
+	t.Run("concurrent invocations", func(t *testing.T) {
+		h := NewHandler(benchmarkHandler, Options{})
+		want, err := h.Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := h.Invoke(context.Background(), benchmarkEvent)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if string(data) != string(want) {
+					t.Errorf("Invoke() = %s, want: %s", data, want)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("lazy handler", func(t *testing.T) {
+		build := func(ctx context.Context) (http.Handler, error) {
+			return nil, errors.New("database unavailable")
+		}
+
+		data, err := NewHandlerFunc(build, Options{EagerInit: true}).Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp Response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusServiceUnavailable)
+		}
+		// the accept header of the event prefers html
+		if resp.Headers["Content-Type"] != "text/html; charset=utf-8" {
+			t.Errorf(`Content-Type = %q, want: %q`, resp.Headers["Content-Type"], "text/html; charset=utf-8")
+		}
+
+		fast, err := NewHandlerFunc(func(ctx context.Context) (http.Handler, error) { return benchmarkHandler, nil }, Options{}).Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slow, err := lambdaruntime.NewHandler(WrapHTTPHandlerFunc(func(ctx context.Context) (http.Handler, error) { return benchmarkHandler, nil }, Options{})).Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(fast) != string(slow) {
+			t.Errorf("Invoke() = %s, want: %s", fast, slow)
+		}
+	})
+
+	t.Run("recover panics", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			panic("oops")
+		})
+		opts := Options{Options: funcserver.Options{
+			RecoverPanics: true,
+			PanicReporter: func(req *http.Request, err error, stack []byte) {},
+		}}
+
+		data, err := NewHandler(h, opts).Invoke(context.Background(), benchmarkEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp Response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusInternalServerError || resp.StatusDescription != "500 Internal Server Error" {
+			t.Errorf(`resp.StatusCode = %d (%q), want: %d`, resp.StatusCode, resp.StatusDescription, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		_, err := NewHandler(benchmarkHandler, Options{}).Invoke(context.Background(), []byte("not json"))
+		if _, ok := err.(*funcserver.EventError); !ok {
+			t.Errorf(`err = %#v, want: *funcserver.EventError`, err)
+		}
+	})
+
+	t.Run("invalid base64 body", func(t *testing.T) {
+		event := []byte(`{"httpMethod":"POST","path":"/lambda","body":"not base64!","isBase64Encoded":true}`)
+
+		_, err := NewHandler(benchmarkHandler, Options{}).Invoke(context.Background(), event)
+		if _, ok := err.(*funcserver.RequestError); !ok {
+			t.Errorf(`err = %#v, want: *funcserver.RequestError`, err)
+		}
+
+		opts := Options{Options: funcserver.Options{RespondToBadRequests: true}}
+		data, err := NewHandler(benchmarkHandler, opts).Invoke(context.Background(), event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp Response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusBadRequest || resp.StatusDescription != "400 Bad Request" {
+			t.Errorf(`resp.StatusCode = %d (%q), want: %d`, resp.StatusCode, resp.StatusDescription, http.StatusBadRequest)
+		}
+	})
+}
+
+// BenchmarkWrapHTTPHandler measures an invocation as the runtime makes it with WrapHTTPHandler, the payload is
+// decoded into a map which is then round tripped through json into a Request.
+func BenchmarkWrapHTTPHandler(b *testing.B) {
+	h := lambdaruntime.NewHandler(WrapHTTPHandler(benchmarkHandler, Options{}))
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := h.Invoke(ctx, benchmarkEvent); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHandlerInvoke measures an invocation with Handler, the payload is decoded straight into a Request.
+func BenchmarkHandlerInvoke(b *testing.B) {
+	h := NewHandler(benchmarkHandler, Options{})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := h.Invoke(ctx, benchmarkEvent); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
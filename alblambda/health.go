@@ -0,0 +1,132 @@
+package alblambda
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/j0hnsmith/funcserver"
+	"github.com/pkg/errors"
+)
+
+// healthCheckUserAgent is the User-Agent prefix of the load balancer's health checks, eg ELB-HealthChecker/2.0.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html#enable-health-checks-lambda
+const healthCheckUserAgent = "ELB-HealthChecker/"
+
+// HealthCheck routes the load balancer's health checks away from the handler, so they don't go through the router &
+// whatever access logging or metrics middleware it has. They don't count towards Options.MaxConcurrency or wait for the
+// OnColdStart hooks, so a busy target still passes. Anyone can send a health check's User-Agent so the responses don't
+// include any details.
+type HealthCheck struct {
+	// Path, if set, is the target group's health check path, health checks for other paths go to the handler.
+	Path string
+
+	// Handler serves the health checks, the default is a liveness response: 200 OK, or 503 Service Unavailable if any
+	// of Checks fail.
+	Handler http.Handler
+
+	// Checks are the dependency checks of the default response, eg pinging the database, they're run concurrently with
+	// the health check's context. Failed checks are logged.
+	Checks map[string]func(ctx context.Context) error
+
+	// Timeout, if set, fails the Checks that haven't returned after it, they're logged as timed out. A check that
+	// ignores its context is left running. Set it below the target group's health check timeout, the request's
+	// context is also cancelled by Options.TimeoutMargin.
+	Timeout time.Duration
+}
+
+// IsHealthCheck reports whether r is a load balancer health check, eg so that logging middleware can skip them when
+// Options.HealthCheck isn't set.
+func IsHealthCheck(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("User-Agent"), healthCheckUserAgent)
+}
+
+// withHealthCheck returns handler with the health checks routed according to opts.HealthCheck, handler if it's nil.
+// Health checks are routed before handler so they don't wait for a MaxConcurrency slot or run the OnColdStart hooks,
+// a busy target is still healthy. TimeoutMargin still applies, a hung check is answered by TimeoutHandler.
+func withHealthCheck(handler funcserver.Handler[Request, Response], opts Options) funcserver.Handler[Request, Response] {
+	hc := opts.HealthCheck
+	if hc == nil {
+		return handler
+	}
+	check := hc.Handler
+	if check == nil {
+		check = http.HandlerFunc(hc.liveness)
+	}
+	opts.MaxConcurrency, opts.OnColdStart = 0, nil
+	checkHandler := funcserver.WrapWithOptions[Request, Response](NewAdapter(opts), check, opts.Options)
+
+	return func(ctx context.Context, albr Request) (Response, error) {
+		if albr.isHealthCheck() && (hc.Path == "" || albr.Path == hc.Path) {
+			return checkHandler(ctx, albr)
+		}
+		return handler(ctx, albr)
+	}
+}
+
+// isHealthCheck is IsHealthCheck for the event, before it's decoded.
+func (albr Request) isHealthCheck() bool {
+	for k, v := range albr.Headers {
+		if strings.EqualFold(k, "User-Agent") {
+			return strings.HasPrefix(v, healthCheckUserAgent)
+		}
+	}
+	for k, vv := range albr.MultiValueHeaders {
+		if strings.EqualFold(k, "User-Agent") && len(vv) > 0 {
+			return strings.HasPrefix(vv[0], healthCheckUserAgent)
+		}
+	}
+	return false
+}
+
+// liveness is the default health check response.
+func (hc *HealthCheck) liveness(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if hc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hc.Timeout)
+		defer cancel()
+	}
+
+	var mu sync.Mutex
+	healthy := true
+	var wg sync.WaitGroup
+	for name, check := range hc.Checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			if err := runCheck(ctx, check); err != nil {
+				log.Printf("alblambda: health check %s failed: %v", name, err)
+				mu.Lock()
+				healthy = false
+				mu.Unlock()
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	w.Header().Set("Cache-Control", "no-store")
+	if !healthy {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("OK\n"))
+}
+
+// runCheck returns the error of check, or a timed out error if ctx is done first.
+func runCheck(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "timed out")
+	}
+}
@@ -0,0 +1,161 @@
+package alblambda
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestHealthCheck(t *testing.T) {
+	router := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Router", "1")
+		res.WriteHeader(http.StatusTeapot)
+	})
+	healthCheck := Request{HTTPMethod: "GET", Path: "/health", Headers: Headers{"user-agent": "ELB-HealthChecker/2.0"}}
+	request := Request{HTTPMethod: "GET", Path: "/health", Headers: Headers{"user-agent": "Mozilla/5.0"}}
+
+	for _, tc := range []struct {
+		name       string
+		hc         *HealthCheck
+		albr       Request
+		wantStatus int
+		wantBody   string
+	}{
+		{"not enabled", nil, healthCheck, http.StatusTeapot, ""},
+		{"not a health check", &HealthCheck{}, request, http.StatusTeapot, ""},
+		{"liveness", &HealthCheck{}, healthCheck, http.StatusOK, "OK\n"},
+		{
+			"checks pass",
+			&HealthCheck{Checks: map[string]func(ctx context.Context) error{
+				"db":    func(ctx context.Context) error { return nil },
+				"cache": func(ctx context.Context) error { return nil },
+			}},
+			healthCheck, http.StatusOK, "OK\n",
+		},
+		{
+			"check fails",
+			&HealthCheck{Checks: map[string]func(ctx context.Context) error{
+				"db":    func(ctx context.Context) error { return errors.New("connection refused") },
+				"cache": func(ctx context.Context) error { return nil },
+			}},
+			healthCheck, http.StatusServiceUnavailable, "Service Unavailable\n",
+		},
+		{
+			"check times out",
+			&HealthCheck{Timeout: 10 * time.Millisecond, Checks: map[string]func(ctx context.Context) error{
+				"db":    func(ctx context.Context) error { time.Sleep(time.Second); return nil },
+				"cache": func(ctx context.Context) error { return nil },
+			}},
+			healthCheck, http.StatusServiceUnavailable, "Service Unavailable\n",
+		},
+		{
+			"handler",
+			&HealthCheck{Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				_, _ = res.Write([]byte("custom"))
+			})},
+			healthCheck, http.StatusOK, "custom",
+		},
+		{"other path", &HealthCheck{Path: "/ping"}, healthCheck, http.StatusTeapot, ""},
+		{"path", &HealthCheck{Path: "/health"}, healthCheck, http.StatusOK, "OK\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := TypedHandler(router, Options{HealthCheck: tc.hc})(context.Background(), tc.albr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, tc.wantStatus)
+			}
+			if resp.Body != tc.wantBody {
+				t.Errorf(`resp.Body = %q, want: %q`, resp.Body, tc.wantBody)
+			}
+			if routed := resp.Headers["X-Router"] == "1"; routed != (tc.wantStatus == http.StatusTeapot) {
+				t.Errorf(`routed to the handler = %t, want: %t`, routed, !routed)
+			}
+		})
+	}
+}
+
+func TestHealthCheckTimeoutLogged(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	hc := &HealthCheck{Timeout: 10 * time.Millisecond, Checks: map[string]func(ctx context.Context) error{
+		"db": func(ctx context.Context) error { time.Sleep(time.Second); return nil },
+	}}
+	healthCheck := Request{HTTPMethod: "GET", Path: "/health", Headers: Headers{"user-agent": "ELB-HealthChecker/2.0"}}
+	if _, err := TypedHandler(http.NotFoundHandler(), Options{HealthCheck: hc})(context.Background(), healthCheck); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "health check db failed: timed out") {
+		t.Errorf(`logs = %q, want the db check timed out`, logs.String())
+	}
+}
+
+func TestHealthCheckBusy(t *testing.T) {
+	healthCheck := Request{HTTPMethod: "GET", Path: "/health", Headers: Headers{"user-agent": "ELB-HealthChecker/2.0"}}
+
+	for _, tc := range []struct {
+		name  string
+		block func(opts *Options, started, release chan struct{}) http.Handler
+	}{
+		{
+			"max concurrency",
+			func(opts *Options, started, release chan struct{}) http.Handler {
+				opts.MaxConcurrency = 1
+				return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					close(started)
+					<-release
+				})
+			},
+		},
+		{
+			"cold start hooks",
+			func(opts *Options, started, release chan struct{}) http.Handler {
+				opts.OnColdStart = []func(ctx context.Context){func(ctx context.Context) {
+					close(started)
+					<-release
+				}}
+				return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			opts := Options{HealthCheck: &HealthCheck{}}
+			opts.TimeoutMargin = time.Second
+			f := TypedHandler(tc.block(&opts, started, release), opts)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if _, err := f(context.Background(), Request{HTTPMethod: "GET", Path: "/"}); err != nil {
+					t.Error(err)
+				}
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			resp, err := f(ctx, healthCheck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusOK)
+			}
+
+			close(release)
+			<-done
+		})
+	}
+}
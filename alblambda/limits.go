@@ -0,0 +1,190 @@
+package alblambda
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/j0hnsmith/funcserver"
+	"github.com/pkg/errors"
+)
+
+// The load balancer's limits for lambda targets, requests & responses over them are rejected by the load balancer.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-limits.html
+const (
+	// MaxRequestBodySize is the largest request body the load balancer sends to a function.
+	MaxRequestBodySize = 1 << 20
+
+	// MaxResponseSize is the largest response a function can return, it's the size of the json encoded Response so it
+	// includes the base64 encoding of a binary body.
+	MaxResponseSize = 1 << 20
+
+	// MaxResponseHeaderSize is the largest total size of the response headers, each header counts as name: value\r\n.
+	MaxResponseHeaderSize = 32 << 10
+)
+
+// OverflowStrategy decides what happens to a response that's over the load balancer's limits, see MaxResponseSize &
+// MaxResponseHeaderSize. Whatever the strategy the response is logged along with the route, if it's still over the
+// limits after the strategy has been applied a 500 Internal Server Error is sent.
+type OverflowStrategy int
+
+const (
+	// OverflowError sends a 500 Internal Server Error instead of the response, otherwise the load balancer rejects the
+	// response & the client gets a 502.
+	OverflowError OverflowStrategy = iota
+	// OverflowCompress gzips the body, if the client accepts gzip & the body isn't already encoded.
+	OverflowCompress
+	// OverflowCallback replaces the response with the one returned by Options.OnOverflow, eg a redirect to a copy of
+	// the body in S3.
+	OverflowCallback
+)
+
+// limitResponse applies opts.Overflow to resp, the encoding of res (the response to req, nil if unknown), if it's over
+// the load balancer's limits.
+func limitResponse(req *http.Request, res funcserver.RecordedResponse, resp Response, opts Options, multiValue bool) (Response, error) {
+	reason, err := overflowReason(resp)
+	if err != nil || reason == "" {
+		return resp, err
+	}
+	route := "unknown route"
+	if req != nil {
+		route = req.Method + " " + req.URL.Path
+	}
+
+	var replaced *funcserver.RecordedResponse
+	var action string
+	switch opts.Overflow {
+	case OverflowCompress:
+		if c, ok := compressResponse(req, res); ok {
+			replaced, action = &c, "sent gzipped"
+		}
+	case OverflowCallback:
+		if opts.OnOverflow != nil {
+			c := opts.OnOverflow(req, res)
+			replaced, action = &c, "sent the OnOverflow response"
+		}
+	}
+
+	if replaced != nil {
+		r, err := buildResponse(*replaced, opts, multiValue)
+		if err != nil {
+			return Response{}, err
+		}
+		still, err := overflowReason(r)
+		if err != nil {
+			return Response{}, err
+		}
+		if still == "" {
+			log.Printf("alblambda: response to %s over the load balancer limits (%s), %s", route, reason, action)
+			return r, nil
+		}
+		reason += ", " + action + " but " + still
+	}
+
+	log.Printf("alblambda: response to %s over the load balancer limits (%s), sent 500 Internal Server Error", route, reason)
+	return buildResponse(funcserver.RecordedResponse{
+		StatusCode: http.StatusInternalServerError,
+		Header: http.Header{
+			"Content-Type":           {"text/plain; charset=utf-8"},
+			"X-Content-Type-Options": {"nosniff"},
+		},
+		Body: []byte(http.StatusText(http.StatusInternalServerError) + "\n"),
+	}, opts, multiValue)
+}
+
+// overflowReason returns why resp is over the load balancer's limits, "" if it isn't.
+func overflowReason(resp Response) (string, error) {
+	if n := headerSize(resp); n > MaxResponseHeaderSize {
+		return fmt.Sprintf("headers are %d bytes, the limit is %d", n, MaxResponseHeaderSize), nil
+	}
+	n, err := responseSize(resp)
+	if err != nil {
+		return "", err
+	}
+	if n > MaxResponseSize {
+		return fmt.Sprintf("response is %d bytes, the limit is %d", n, MaxResponseSize), nil
+	}
+	return "", nil
+}
+
+// headerSize returns the size of resp's headers as they're sent to the client.
+func headerSize(resp Response) int {
+	var n int
+	for k, v := range resp.Headers {
+		n += len(k) + len(v) + 4
+	}
+	for k, vv := range resp.MultiValueHeaders {
+		for _, v := range vv {
+			n += len(k) + len(v) + 4
+		}
+	}
+	return n
+}
+
+// maxEscapeRatio is the most a string can grow by when it's json encoded, a control character becomes \u00XX.
+const maxEscapeRatio = 6
+
+// responseSize returns the size of the json encoding of resp, or an estimate if it's well under MaxResponseSize. The
+// response is only encoded if it might be over the limit, the payload is encoded again when it's returned.
+func responseSize(resp Response) (int, error) {
+	// the status description & field names are small, json escaping can't make a string more than 6 times longer
+	n := len(resp.Body) + headerSize(resp) + 256
+	if maxEscapeRatio*n <= MaxResponseSize {
+		return n, nil
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to marshal response")
+	}
+	return len(data), nil
+}
+
+// compressResponse returns res with a gzipped body, false if req doesn't accept gzip or the body is already encoded.
+func compressResponse(req *http.Request, res funcserver.RecordedResponse) (funcserver.RecordedResponse, bool) {
+	if req == nil || !acceptsGzip(req.Header.Get("Accept-Encoding")) || res.Header.Get("Content-Encoding") != "" {
+		return res, false
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(res.Body); err != nil {
+		return res, false
+	}
+	if err := zw.Close(); err != nil {
+		return res, false
+	}
+
+	h := res.Header.Clone()
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+	return funcserver.RecordedResponse{StatusCode: res.StatusCode, Header: h, Body: buf.Bytes()}, true
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, an explicit gzip entry takes precedence over *.
+func acceptsGzip(accept string) bool {
+	gzip, star := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzip = q
+		case "*":
+			star = q
+		}
+	}
+	if gzip >= 0 {
+		return gzip > 0
+	}
+	return star > 0
+}
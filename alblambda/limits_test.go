@@ -0,0 +1,140 @@
+package alblambda
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+func TestLimits(t *testing.T) {
+	big := strings.Repeat("a", MaxResponseSize)
+	bigHandler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/plain")
+		_, _ = res.Write([]byte(big))
+	})
+	albr := Request{HTTPMethod: "GET", Path: "/big", Headers: Headers{"accept-encoding": "gzip, deflate"}}
+
+	t.Run("under the limits", func(t *testing.T) {
+		resp, err := TypedHandler(benchmarkHandler, Options{})(context.Background(), albr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusOK)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		resp, err := TypedHandler(bigHandler, Options{})(context.Background(), albr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("header size", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("X-Big", strings.Repeat("a", MaxResponseHeaderSize))
+		})
+		resp, err := TypedHandler(h, Options{Overflow: OverflowCompress})(context.Background(), albr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("compress", func(t *testing.T) {
+		resp, err := TypedHandler(bigHandler, Options{Overflow: OverflowCompress})(context.Background(), albr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Headers["Content-Encoding"] != "gzip" || !resp.IsBase64Encoded {
+			t.Fatalf(`resp = %d %v, want: %d gzipped`, resp.StatusCode, resp.Headers, http.StatusOK)
+		}
+
+		data, _ := base64.StdEncoding.DecodeString(resp.Body)
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != big {
+			t.Errorf(`len(body) = %d, want: %d`, len(body), len(big))
+		}
+
+		noGzip := albr
+		noGzip.Headers = Headers{"accept-encoding": "gzip;q=0, br"}
+		resp, err = TypedHandler(bigHandler, Options{Overflow: OverflowCompress})(context.Background(), noGzip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusInternalServerError)
+		}
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		opts := Options{
+			Overflow: OverflowCallback,
+			OnOverflow: func(req *http.Request, res funcserver.RecordedResponse) funcserver.RecordedResponse {
+				return funcserver.RecordedResponse{
+					StatusCode: http.StatusFound,
+					Header:     http.Header{"Location": {"https://bucket.s3.amazonaws.com" + req.URL.Path}},
+				}
+			},
+		}
+		resp, err := TypedHandler(bigHandler, opts)(context.Background(), albr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusFound || resp.Headers["Location"] != "https://bucket.s3.amazonaws.com/big" {
+			t.Errorf(`resp = %d %v, want: %d redirect`, resp.StatusCode, resp.Headers, http.StatusFound)
+		}
+	})
+
+	t.Run("request body", func(t *testing.T) {
+		r, _ := http.NewRequest("POST", "/", strings.NewReader(big+"a"))
+		if _, err := FromHTTPRequest(r, false); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"br, gzip;q=0.5", true},
+		{"gzip;q=0, br", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"*;q=0, gzip", true},
+		{"gzip, *;q=0", true},
+		{"*, gzip;q=0", false},
+		{"deflate", false},
+	} {
+		t.Run(tc.accept, func(t *testing.T) {
+			if got := acceptsGzip(tc.accept); got != tc.want {
+				t.Errorf(`acceptsGzip(%q) = %t, want: %t`, tc.accept, got, tc.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package alblambda
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
-	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -14,40 +17,62 @@ import (
 	"github.com/j0hnsmith/funcserver"
 )
 
-// An aLBRequest represents an http request received by an application load balancer and forwarded to a alblambda function.
-// It's container to marshal json into that can be converted to a *http.Request.
+// A Request represents an http request received by an application load balancer and forwarded to a alblambda function.
+// It's container to marshal json into that can be converted to a *http.Request, the json follows the documented event
+// schema.
 // https://docs.aws.amazon.com/lambda/latest/dg/services-alb.html
-type aLBRequest struct {
-	RequestContext                  requestContext          `json:"requestContext"`
-	HTTPMethod                      string                  `json:"httpMethod"`
-	Path                            string                  `json:"path"`
-	QueryStringParameters           queryStringParameters   `json:"queryStringParameters,omitempty"`
-	MultiValueQueryStringParameters mVQueryStringParameters `json:"mVQueryStringParameters,omitempty"`
-	Headers                         Headers                 `json:"Headers,omitempty"`
-	MultiValueHeaders               http.Header             `json:"multiValueHeaders,omitempty"`
-	IsBase64Encoded                 bool                    `json:"isBase64Encoded"`
+type Request struct {
+	RequestContext                  RequestContext                  `json:"requestContext"`
+	HTTPMethod                      string                          `json:"httpMethod"`
+	Path                            string                          `json:"path"`
+	QueryStringParameters           QueryStringParameters           `json:"queryStringParameters,omitempty"`
+	MultiValueQueryStringParameters MultiValueQueryStringParameters `json:"multiValueQueryStringParameters,omitempty"`
+	Headers                         Headers                         `json:"headers,omitempty"`
+	MultiValueHeaders               http.Header                     `json:"multiValueHeaders,omitempty"`
+	IsBase64Encoded                 bool                            `json:"isBase64Encoded"`
 
 	// limited to 1mb in size
 	// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html
 	Body string `json:"body"`
 }
 
-var _ funcserver.RequestConverter = aLBRequest{}
+var _ funcserver.RequestConverter = Request{}
+
+// contextKey is the type of the context keys private to this package.
+type contextKey int
+
+const (
+	// multiValueContextKey is whether the request used multi value headers, the response must use the same mode.
+	multiValueContextKey contextKey = iota
+	elbContextKey
+)
+
+// ELBFromContext returns the load balancer info of the request, eg the target group ARN.
+func ELBFromContext(ctx context.Context) (ELB, bool) {
+	elb, ok := ctx.Value(elbContextKey).(ELB)
+	return elb, ok
+}
 
 // ELB holds information about the elastic load balancer that received the http request.
-// This is accessed via the context on a http.Request, eg ctx.Get("elb"), then type assert.
+// This is accessed via the context on a http.Request, see ELBFromContext. It's also stored under the deprecated
+// funcserver.ContextKey("elb").
 type ELB struct {
 	TargetGroupArn string `json:"targetGroupArn"`
 }
 
-// requestContext holds information pertinent to the request.
-type requestContext struct {
+// RequestContext holds information pertinent to the request.
+type RequestContext struct {
 	ELB `json:"elb"`
 }
 
 // AsHTTPRequest converts to the equivalent *http.Request so that the request can be processed via standard net/http
-// functionality.
-func (albr aLBRequest) AsHTTPRequest(ctx context.Context) (*http.Request, error) {
+// functionality. The fields net/http.Server sets from the connection (Host, RemoteAddr, TLS etc) are set from the
+// headers the load balancer adds, see Options.TrustedProxies.
+func (albr Request) AsHTTPRequest(ctx context.Context) (*http.Request, error) {
+	return albr.asHTTPRequest(ctx, Options{})
+}
+
+func (albr Request) asHTTPRequest(ctx context.Context, opts Options) (*http.Request, error) {
 	var qp string
 	if len(albr.MultiValueQueryStringParameters) > 0 {
 		qp = albr.MultiValueQueryStringParameters.AsQueryString()
@@ -58,73 +83,261 @@ func (albr aLBRequest) AsHTTPRequest(ctx context.Context) (*http.Request, error)
 
 	var headers http.Header
 	if len(albr.MultiValueHeaders) > 0 {
-		headers = albr.MultiValueHeaders
+		// alb sends lower case header names
+		headers = make(http.Header, len(albr.MultiValueHeaders))
+		for k, vv := range albr.MultiValueHeaders {
+			for _, v := range vv {
+				headers.Add(k, v)
+			}
+		}
 	} else {
 		headers = albr.Headers.AsHTTPHeader()
 	}
 
-	bodyStr := albr.Body
-	if albr.IsBase64Encoded {
-		decoded, err := base64.StdEncoding.DecodeString(albr.Body)
-		if err != nil {
-			return nil, errors.Wrapf(err, "unable to decode body as base64: %s", albr.Body)
-		}
-		bodyStr = string(decoded)
-	}
+	bodyStr, bodyErr := funcserver.DecodeBody(albr.Body, albr.IsBase64Encoded)
+
+	u := &url.URL{RawQuery: qp}
+	funcserver.SetPath(u, albr.Path)
 
 	r := &http.Request{
-		Method: albr.HTTPMethod,
-		URL: &url.URL{
-			Path:     albr.Path,
-			RawQuery: qp,
-		},
-		Header: headers,
-		Body:   ioutil.NopCloser(strings.NewReader(bodyStr)),
+		Method:        albr.HTTPMethod,
+		URL:           u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          ioutil.NopCloser(strings.NewReader(bodyStr)),
+		ContentLength: int64(len(bodyStr)),
 	}
+	setForwarded(r, opts.TrustedProxies)
 
+	ctx = context.WithValue(ctx, elbContextKey, albr.RequestContext.ELB)
+	// the documented key before ELBFromContext, kept while funcserver.ContextKey is deprecated
 	ctx = context.WithValue(ctx, funcserver.ContextKey("elb"), albr.RequestContext.ELB)
+	ctx = context.WithValue(ctx, multiValueContextKey, albr.MultiValueHeaders != nil || albr.MultiValueQueryStringParameters != nil)
 	r = r.WithContext(ctx)
 
+	if bodyErr != nil {
+		return nil, &funcserver.RequestError{Request: r, Err: bodyErr}
+	}
 	return r, nil
 }
 
-// queryStringParameters is a container for query params.
-type queryStringParameters map[string]string
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// setForwarded sets the fields of r that net/http.Server would set from the connection, the load balancer passes them
+// on via the Host & X-Forwarded-* headers. As with net/http.Server the Host header is removed from r.Header.
+func setForwarded(r *http.Request, trusted []netip.Prefix) {
+	r.Host = r.Header.Get("Host")
+	r.Header.Del("Host")
 
-// AsQueryString converts to a querystring as it's not possible to pass url.Values into a net.URL.
-func (qsp queryStringParameters) AsQueryString() string {
-	b := new(strings.Builder)
-	first := true
-	for k, v := range qsp {
-		if first {
-			first = false
-		} else {
-			b.WriteString("&") // nolint: gosec
+	scheme := strings.ToLower(r.Header.Get("X-Forwarded-Proto"))
+	if scheme != "https" {
+		scheme = "http"
+	}
+	port := r.Header.Get("X-Forwarded-Port")
+	if _, _, err := net.SplitHostPort(r.Host); err != nil && r.Host != "" && port != "" && port != defaultPorts[scheme] {
+		// an IPv6 literal is already in brackets, JoinHostPort adds them
+		r.Host = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]"), port)
+	}
+	funcserver.SetServerFields(r, scheme, clientIP(r.Header.Values("X-Forwarded-For"), trusted))
+}
+
+// clientIP returns the right most address in X-Forwarded-For that isn't in one of the trusted networks. The load
+// balancer appends the address it received the request from, anything to the left of that could have been sent by the
+// client.
+func clientIP(xff []string, trusted []netip.Prefix) netip.Addr {
+	var addrs []string
+	for _, v := range xff {
+		addrs = append(addrs, strings.Split(v, ",")...)
+	}
+
+	var ip netip.Addr
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(addrs[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.Unmap()
+		if !isTrusted(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromHTTPRequest converts a *http.Request into the equivalent Request, as an application load balancer would send it
+// to a lambda function. multiValue should match the target group's multi value headers setting, if true the multi
+// value fields are populated, otherwise the single value fields are (the last value wins for repeated query params &
+// headers). Header names are lower cased, the path & query params are passed through without decoding and the body is base64
+// encoded unless it's text. The body of r is read and replaced so that r can still be used.
+//
+// RequestContext isn't populated as it's not derivable from r. A body over MaxRequestBodySize is an error, the load
+// balancer wouldn't send it to a function.
+func FromHTTPRequest(r *http.Request, multiValue bool) (Request, error) {
+	albr := Request{
+		HTTPMethod: r.Method,
+		Path:       r.URL.EscapedPath(),
+	}
+
+	headers := make(http.Header, len(r.Header)+1)
+	for k, vv := range r.Header {
+		headers[strings.ToLower(k)] = vv
+	}
+	if r.Host != "" {
+		headers["host"] = []string{r.Host}
+	}
+
+	query := make(map[string][]string)
+	for _, kv := range strings.Split(r.URL.RawQuery, "&") {
+		if kv == "" {
+			continue
+		}
+		k, v := kv, ""
+		if i := strings.Index(kv, "="); i >= 0 {
+			k, v = kv[:i], kv[i+1:]
 		}
-		_, _ = fmt.Fprintf(b, "%s=%s", k, v) // nolint: gosec
+		query[k] = append(query[k], v)
+	}
+
+	if multiValue {
+		albr.MultiValueHeaders = headers
+		albr.MultiValueQueryStringParameters = query
+	} else {
+		albr.Headers = make(Headers, len(headers))
+		for k, vv := range headers {
+			albr.Headers[k] = vv[len(vv)-1]
+		}
+		albr.QueryStringParameters = make(QueryStringParameters, len(query))
+		for k, vv := range query {
+			albr.QueryStringParameters[k] = vv[len(vv)-1]
+		}
+	}
+
+	if r.Body != nil {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return albr, errors.Wrap(err, "unable to read request body")
+		}
+		_ = r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if len(body) > MaxRequestBodySize {
+			return albr, errors.Errorf("request body is %d bytes, the load balancer limit is %d", len(body), MaxRequestBodySize)
+		}
+
+		albr.Body = string(body)
+		if len(body) > 0 && funcserver.UseBase64(r.Header.Get("Content-Type")) {
+			albr.IsBase64Encoded = true
+			albr.Body = base64.StdEncoding.EncodeToString(body)
+		}
+	}
+
+	return albr, nil
+}
+
+// QueryStringParameters is a container for query params. The load balancer doesn't decode query params, keys & values
+// are as the client sent them.
+type QueryStringParameters map[string]string
+
+// AsQueryString converts to a querystring as it's not possible to pass url.Values into a net.URL. Keys are sorted so
+// the result is deterministic, see escapeQuery for the encoding.
+func (qsp QueryStringParameters) AsQueryString() string {
+	keys := make([]string, 0, len(qsp))
+	for k := range qsp {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := new(strings.Builder)
+	for _, k := range keys {
+		writeQueryParam(b, k, qsp[k])
 	}
 	return b.String()
 }
 
-// mVQueryStringParameters is a container for multi value query params. Must be explicitly enabled, mutually
-// exclusive with queryStringParameters.
+// MultiValueQueryStringParameters is a container for multi value query params. Must be explicitly enabled, mutually
+// exclusive with QueryStringParameters.
 // https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html#multi-value-headers
-type mVQueryStringParameters map[string][]string
+type MultiValueQueryStringParameters map[string][]string
 
 // AsQueryString converts to a querystring with multiple values as it's not possible to pass
-// url.Values into a net.URL.
-func (mqsp mVQueryStringParameters) AsQueryString() string {
+// url.Values into a net.URL. Keys are sorted, values for a key keep their order.
+func (mqsp MultiValueQueryStringParameters) AsQueryString() string {
+	keys := make([]string, 0, len(mqsp))
+	for k := range mqsp {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	b := new(strings.Builder)
-	first := true
-	for k, items := range mqsp {
-		for _, v := range items {
-			if first {
-				first = false
-			} else {
-				b.WriteString("&") // nolint: gosec
-			}
-			_, _ = fmt.Fprintf(b, "%s=%s", k, v)
+	for _, k := range keys {
+		for _, v := range mqsp[k] {
+			writeQueryParam(b, k, v)
 		}
 	}
 	return b.String()
 }
+
+func writeQueryParam(b *strings.Builder, k, v string) {
+	if b.Len() > 0 {
+		b.WriteByte('&')
+	}
+	b.WriteString(escapeQuery(k, true))
+	b.WriteByte('=')
+	b.WriteString(escapeQuery(v, false))
+}
+
+// escapeQuery escapes the characters in s, a query param key or value as received by the load balancer, that would
+// change the meaning of the query string (or make it invalid). Valid percent escapes are kept as they are, the load
+// balancer passes them through without decoding them.
+func escapeQuery(s string, key bool) string {
+	escape := func(i int) bool {
+		c := s[i]
+		switch {
+		case c == '%':
+			return i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2])
+		case c == '=':
+			return key
+		case c == '&' || c == '#' || c == ';' || c <= ' ' || c >= 0x7f:
+			return true
+		}
+		return false
+	}
+
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if escape(i) {
+			n++
+		}
+	}
+	if n == 0 {
+		return s
+	}
+
+	const upperhex = "0123456789ABCDEF"
+	b := make([]byte, 0, len(s)+2*n)
+	for i := 0; i < len(s); i++ {
+		if escape(i) {
+			b = append(b, '%', upperhex[s[i]>>4], upperhex[s[i]&15])
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -1,12 +1,17 @@
 package alblambda
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/j0hnsmith/funcserver"
@@ -21,9 +26,9 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 			}
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
+		f := WrapHTTPHandler(h, Options{})
 
-		albr := aLBRequest{HTTPMethod: expectedMethod}
+		albr := Request{HTTPMethod: expectedMethod}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err != nil {
 			t.Error(err)
@@ -38,8 +43,8 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 			}
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
-		albr := aLBRequest{Path: expectedPath}
+		f := WrapHTTPHandler(h, Options{})
+		albr := Request{Path: expectedPath}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err != nil {
 			t.Error(err)
@@ -51,7 +56,7 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 		val1 := "someVal1"
 		key2 := "someKey2"
 		val2 := "someVal2"
-		qp := make(queryStringParameters)
+		qp := make(QueryStringParameters)
 		qp[key1] = val1
 		qp[key2] = val2
 
@@ -65,8 +70,8 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 			}
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
-		albr := aLBRequest{QueryStringParameters: qp}
+		f := WrapHTTPHandler(h, Options{})
+		albr := Request{QueryStringParameters: qp}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err != nil {
 			t.Error(err)
@@ -79,7 +84,7 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 		key2 := "someKey2"
 		val2 := []string{"someVal2-1", "someVal2-2"}
 
-		qp := make(mVQueryStringParameters)
+		qp := make(MultiValueQueryStringParameters)
 		qp[key1] = val1
 		qp[key2] = val2
 
@@ -93,14 +98,88 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 			}
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
-		albr := aLBRequest{MultiValueQueryStringParameters: qp}
+		f := WrapHTTPHandler(h, Options{})
+		albr := Request{MultiValueQueryStringParameters: qp}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err != nil {
 			t.Error(err)
 		}
 	})
 
+	t.Run("query encoding", func(t *testing.T) {
+		for _, tc := range []struct {
+			name      string
+			albr      Request
+			wantRaw   string
+			wantQuery map[string][]string
+		}{
+			{
+				name:      "escapes kept",
+				albr:      Request{QueryStringParameters: QueryStringParameters{"b": "x%26y", "a": "%2Fpath%20here", "c": "1+2"}},
+				wantRaw:   "a=%2Fpath%20here&b=x%26y&c=1+2",
+				wantQuery: map[string][]string{"a": {"/path here"}, "b": {"x&y"}, "c": {"1 2"}},
+			},
+			{
+				name:      "unescaped special chars",
+				albr:      Request{QueryStringParameters: QueryStringParameters{"k=1": "a&b=c d#e;f"}},
+				wantRaw:   "k%3D1=a%26b=c%20d%23e%3Bf",
+				wantQuery: map[string][]string{"k=1": {"a&b=c d#e;f"}},
+			},
+			{
+				name:      "invalid escape & unicode",
+				albr:      Request{QueryStringParameters: QueryStringParameters{"q": "100%zz", "é": "ü"}},
+				wantRaw:   "q=100%25zz&%C3%A9=%C3%BC",
+				wantQuery: map[string][]string{"q": {"100%zz"}, "é": {"ü"}},
+			},
+			{
+				name:      "multi value order",
+				albr:      Request{MultiValueQueryStringParameters: MultiValueQueryStringParameters{"z": {"2", "1"}, "a": {"x y"}}},
+				wantRaw:   "a=x%20y&z=2&z=1",
+				wantQuery: map[string][]string{"a": {"x y"}, "z": {"2", "1"}},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				req, err := tc.albr.AsHTTPRequest(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if req.URL.RawQuery != tc.wantRaw {
+					t.Errorf(`req.URL.RawQuery = %q, want: %q`, req.URL.RawQuery, tc.wantRaw)
+				}
+				query, err := url.ParseQuery(req.URL.RawQuery)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(map[string][]string(query), tc.wantQuery) {
+					t.Errorf(`query = %q, want: %q`, query, tc.wantQuery)
+				}
+			})
+		}
+	})
+
+	t.Run("path encoding", func(t *testing.T) {
+		for _, tc := range []struct {
+			path, wantPath, wantRawPath, wantEscaped string
+		}{
+			{"/some/path", "/some/path", "", "/some/path"},
+			{"/a%20b", "/a b", "", "/a%20b"},
+			{"/files/a%2Fb", "/files/a/b", "/files/a%2Fb", "/files/a%2Fb"},
+			{"/a b", "/a b", "", "/a%20b"},
+			{"/100%", "/100%", "", "/100%25"},
+		} {
+			req, err := Request{Path: tc.path}.AsHTTPRequest(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.URL.Path != tc.wantPath || req.URL.RawPath != tc.wantRawPath {
+				t.Errorf(`%q: req.URL.Path, RawPath = %q, %q, want: %q, %q`, tc.path, req.URL.Path, req.URL.RawPath, tc.wantPath, tc.wantRawPath)
+			}
+			if req.URL.EscapedPath() != tc.wantEscaped {
+				t.Errorf(`%q: req.URL.EscapedPath() = %q, want: %q`, tc.path, req.URL.EscapedPath(), tc.wantEscaped)
+			}
+		}
+	})
+
 	t.Run("single value Headers", func(t *testing.T) {
 		key1 := "Content-Type"
 		val1 := "application/json"
@@ -119,8 +198,8 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 			}
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
-		albr := aLBRequest{Headers: headers}
+		f := WrapHTTPHandler(h, Options{})
+		albr := Request{Headers: headers}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err != nil {
 			t.Error(err)
@@ -145,8 +224,8 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 			}
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
-		albr := aLBRequest{MultiValueHeaders: mvh}
+		f := WrapHTTPHandler(h, Options{})
+		albr := Request{MultiValueHeaders: mvh}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err != nil {
 			t.Error(err)
@@ -187,8 +266,8 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 					}
 				})
 
-				f := WrapHTTPHandler(h, ResponseOptions{})
-				albr := aLBRequest{Body: tc.rawBody, IsBase64Encoded: tc.isBase64Encoded}
+				f := WrapHTTPHandler(h, Options{})
+				albr := Request{Body: tc.rawBody, IsBase64Encoded: tc.isBase64Encoded}
 				_, err := f(context.Background(), albrToMapStringInterface(albr))
 				if err != nil {
 					t.Error(err)
@@ -198,7 +277,7 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 	})
 
 	t.Run("context", func(t *testing.T) {
-		rc := requestContext{
+		rc := RequestContext{
 			ELB: ELB{
 				TargetGroupArn: "arn:aws:elasticloadbalancing:region:123456789012:targetgroup/my-target-group/6d0ecf831eec9f09",
 			},
@@ -206,29 +285,120 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 
 		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 			ctx := req.Context()
-			elb := ctx.Value(funcserver.ContextKey("elb")).(ELB)
+			elb, _ := ELBFromContext(ctx)
 			if elb.TargetGroupArn != rc.ELB.TargetGroupArn {
 				t.Errorf(`elb.TargetGroupArn = %q, want: %q`, elb.TargetGroupArn, rc.ELB.TargetGroupArn)
 			}
+			// the deprecated key
+			legacy, _ := ctx.Value(funcserver.ContextKey("elb")).(ELB)
+			if legacy.TargetGroupArn != rc.ELB.TargetGroupArn {
+				t.Errorf(`legacy.TargetGroupArn = %q, want: %q`, legacy.TargetGroupArn, rc.ELB.TargetGroupArn)
+			}
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
+		f := WrapHTTPHandler(h, Options{})
 
-		albr := aLBRequest{RequestContext: rc}
+		albr := Request{RequestContext: rc}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err != nil {
 			t.Error(err)
 		}
 	})
 
+	t.Run("forwarded", func(t *testing.T) {
+		headers := Headers{
+			"host":              "example.com",
+			"x-forwarded-for":   "10.0.0.1, 203.0.113.7, 130.176.1.2",
+			"x-forwarded-proto": "https",
+			"x-forwarded-port":  "8443",
+		}
+		cdn := []netip.Prefix{netip.MustParsePrefix("130.176.0.0/16")}
+
+		for _, tc := range []struct {
+			name           string
+			trusted        []netip.Prefix
+			wantRemoteAddr string
+		}{
+			{"load balancer peer", nil, "130.176.1.2:0"},
+			{"trusted proxy", cdn, "203.0.113.7:0"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				albr := Request{HTTPMethod: http.MethodPost, Path: "/a b", QueryStringParameters: QueryStringParameters{"q": "1"}, Headers: headers, Body: "body"}
+				req, err := NewAdapter(Options{TrustedProxies: tc.trusted}).DecodeRequest(context.Background(), albr)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if req.RemoteAddr != tc.wantRemoteAddr {
+					t.Errorf(`req.RemoteAddr = %q, want: %q`, req.RemoteAddr, tc.wantRemoteAddr)
+				}
+				if req.Host != "example.com:8443" || req.Header.Get("Host") != "" {
+					t.Errorf(`req.Host = %q (header %q), want: %q`, req.Host, req.Header.Get("Host"), "example.com:8443")
+				}
+				if req.URL.String() != "https://example.com:8443/a%20b?q=1" {
+					t.Errorf(`req.URL = %q, want: %q`, req.URL.String(), "https://example.com:8443/a%20b?q=1")
+				}
+				if req.TLS == nil || req.TLS.ServerName != "example.com" {
+					t.Errorf(`req.TLS = %v, want: ServerName %q`, req.TLS, "example.com")
+				}
+				if req.RequestURI != "/a%20b?q=1" {
+					t.Errorf(`req.RequestURI = %q, want: %q`, req.RequestURI, "/a%20b?q=1")
+				}
+				if req.Proto != "HTTP/1.1" || req.ContentLength != 4 {
+					t.Errorf(`req.Proto = %q, req.ContentLength = %d, want: "HTTP/1.1", 4`, req.Proto, req.ContentLength)
+				}
+			})
+		}
+
+		t.Run("http default port", func(t *testing.T) {
+			albr := Request{Headers: Headers{"host": "example.com", "x-forwarded-proto": "http", "x-forwarded-port": "80"}}
+			req, err := albr.AsHTTPRequest(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.Host != "example.com" || req.URL.Scheme != "http" || req.TLS != nil {
+				t.Errorf(`req.Host = %q, req.URL.Scheme = %q, req.TLS = %v, want: "example.com", "http", nil`, req.Host, req.URL.Scheme, req.TLS)
+			}
+			if req.RemoteAddr != "" {
+				t.Errorf(`req.RemoteAddr = %q, want: %q`, req.RemoteAddr, "")
+			}
+		})
+
+		t.Run("ipv6 host", func(t *testing.T) {
+			for _, tc := range []struct {
+				host, port     string
+				wantHost       string
+				wantServerName string
+			}{
+				{"[::1]", "8443", "[::1]:8443", "::1"},
+				{"[::1]", "443", "[::1]", "::1"},
+				{"[::1]:8443", "8443", "[::1]:8443", "::1"},
+			} {
+				t.Run(tc.host+" "+tc.port, func(t *testing.T) {
+					albr := Request{Headers: Headers{"host": tc.host, "x-forwarded-proto": "https", "x-forwarded-port": tc.port}}
+					req, err := albr.AsHTTPRequest(context.Background())
+					if err != nil {
+						t.Fatal(err)
+					}
+					if req.Host != tc.wantHost {
+						t.Errorf(`req.Host = %q, want: %q`, req.Host, tc.wantHost)
+					}
+					if req.TLS == nil || req.TLS.ServerName != tc.wantServerName {
+						t.Errorf(`req.TLS = %v, want: ServerName %q`, req.TLS, tc.wantServerName)
+					}
+				})
+			}
+		})
+	})
+
 	t.Run("invalid status panic recover", func(t *testing.T) {
 		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 			res.WriteHeader(999)
 		})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
+		f := WrapHTTPHandler(h, Options{})
 
-		albr := aLBRequest{}
+		albr := Request{}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err == nil {
 			t.Error("expected error, got nil")
@@ -238,9 +408,9 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 	t.Run("req body encoding error", func(t *testing.T) {
 		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
 
-		f := WrapHTTPHandler(h, ResponseOptions{})
+		f := WrapHTTPHandler(h, Options{})
 
-		albr := aLBRequest{Body: "not base64", IsBase64Encoded: true}
+		albr := Request{Body: "not base64", IsBase64Encoded: true}
 		_, err := f(context.Background(), albrToMapStringInterface(albr))
 		if err == nil {
 			t.Error("expected error, got nil")
@@ -248,10 +418,113 @@ func TestRequest(t *testing.T) { // nolint: gocyclo
 	})
 }
 
-func albrToMapStringInterface(albr aLBRequest) map[string]interface{} {
+func TestFromHTTPRequest(t *testing.T) {
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/some/path?a=1&a=2&b=x%26y", strings.NewReader("request body"))
+		r.Header.Set("Content-Type", "text/plain")
+		r.Header.Add("Cookie", "c=1")
+		r.Header.Add("Cookie", "d=2")
+		return r
+	}
+
+	t.Run("single value", func(t *testing.T) {
+		albr, err := FromHTTPRequest(newRequest(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if albr.HTTPMethod != http.MethodPost {
+			t.Errorf(`albr.HTTPMethod = %q, want: %q`, albr.HTTPMethod, http.MethodPost)
+		}
+		if albr.Path != "/some/path" {
+			t.Errorf(`albr.Path = %q, want: %q`, albr.Path, "/some/path")
+		}
+		expectedQuery := QueryStringParameters{"a": "2", "b": "x%26y"}
+		if !reflect.DeepEqual(albr.QueryStringParameters, expectedQuery) {
+			t.Errorf(`albr.QueryStringParameters = %v, want: %v`, albr.QueryStringParameters, expectedQuery)
+		}
+		if albr.Headers["cookie"] != "d=2" {
+			t.Errorf(`albr.Headers["cookie"] = %q, want: %q`, albr.Headers["cookie"], "d=2")
+		}
+		if albr.Headers["host"] != "example.com" {
+			t.Errorf(`albr.Headers["host"] = %q, want: %q`, albr.Headers["host"], "example.com")
+		}
+		if albr.MultiValueHeaders != nil || albr.MultiValueQueryStringParameters != nil {
+			t.Error("multi value fields populated in single value mode")
+		}
+		if albr.Body != "request body" || albr.IsBase64Encoded {
+			t.Errorf(`albr.Body = %q (b64 %t), want: %q (b64 false)`, albr.Body, albr.IsBase64Encoded, "request body")
+		}
+	})
+
+	t.Run("multi value", func(t *testing.T) {
+		albr, err := FromHTTPRequest(newRequest(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(albr.MultiValueQueryStringParameters["a"], []string{"1", "2"}) {
+			t.Errorf(`albr.MultiValueQueryStringParameters["a"] = %q, want: %q`, albr.MultiValueQueryStringParameters["a"], []string{"1", "2"})
+		}
+		if !reflect.DeepEqual(albr.MultiValueHeaders["cookie"], []string{"c=1", "d=2"}) {
+			t.Errorf(`albr.MultiValueHeaders["cookie"] = %q, want: %q`, albr.MultiValueHeaders["cookie"], []string{"c=1", "d=2"})
+		}
+		if albr.Headers != nil || albr.QueryStringParameters != nil {
+			t.Error("single value fields populated in multi value mode")
+		}
+	})
+
+	t.Run("binary body", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte{0, 1, 2}))
+		r.Header.Set("Content-Type", "application/octet-stream")
+
+		albr, err := FromHTTPRequest(r, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if albr.Body != "AAEC" || !albr.IsBase64Encoded {
+			t.Errorf(`albr.Body = %q (b64 %t), want: %q (b64 true)`, albr.Body, albr.IsBase64Encoded, "AAEC")
+		}
+
+		// body is still readable
+		body, _ := ioutil.ReadAll(r.Body)
+		if !bytes.Equal(body, []byte{0, 1, 2}) {
+			t.Errorf(`r.Body = %v, want: %v`, body, []byte{0, 1, 2})
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, multiValue := range []bool{false, true} {
+			albr, err := FromHTTPRequest(newRequest(), multiValue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := albr.AsHTTPRequest(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Method != http.MethodPost || r.URL.Path != "/some/path" {
+				t.Errorf(`r = %s %s, want: POST /some/path`, r.Method, r.URL.Path)
+			}
+			if r.URL.Query().Get("b") != "x&y" {
+				t.Errorf(`r.URL.Query().Get("b") = %q, want: %q`, r.URL.Query().Get("b"), "x&y")
+			}
+			if r.Header.Get("Content-Type") != "text/plain" {
+				t.Errorf(`r.Header.Get("Content-Type") = %q, want: %q`, r.Header.Get("Content-Type"), "text/plain")
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != "request body" {
+				t.Errorf(`body = %q, want: %q`, body, "request body")
+			}
+		}
+	})
+}
+
+func albrToMapStringInterface(albr Request) map[string]interface{} {
 	data, err := json.Marshal(albr)
 	if err != nil {
-		panic("unable to marshal aLBRequest")
+		panic("unable to marshal Request")
 	}
 
 	m := make(map[string]interface{})
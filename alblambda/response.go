@@ -4,169 +4,218 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"sort"
 	"strings"
-)
 
-// ResponseOptions holds the options for responses.
-type ResponseOptions struct {
-	// Multi value Headers must be explicitly enabled
-	// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html#multi-value-headers
-	MultiValueHeaders bool
-}
+	"github.com/j0hnsmith/funcserver"
+	"github.com/pkg/errors"
+)
 
-// Response represents a response sent to the load balancer.
+// Response represents a response sent to the load balancer. Only one of Headers & MultiValueHeaders is sent, depending
+// on whether the target group has multi value headers enabled.
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/lambda-functions.html#respond-to-load-balancer
 type Response struct {
 	IsBase64Encoded   bool        `json:"isBase64Encoded"`
 	StatusCode        int         `json:"statusCode"`
 	StatusDescription string      `json:"statusDescription"`
-	Headers           Headers     `json:"headers"`
-	MultiValueHeaders http.Header `json:"multiValueHeaders"`
+	Headers           Headers     `json:"headers,omitempty"`
+	MultiValueHeaders http.Header `json:"multiValueHeaders,omitempty"`
 	Body              string      `json:"body"`
 }
 
-func newLambdaResponseWriter(opts ResponseOptions) *responseWriter {
-	rw := &responseWriter{
-		opts:          opts,
-		header:        make(http.Header),
-		handlerHeader: make(http.Header),
-	}
-	return rw
-}
-
-type responseWriter struct {
-	opts              ResponseOptions
-	writeHeaderCalled bool
-
-	// handlerHeader is the Header that Handlers get access to,
-	// which may be retained and mutated even after WriteHeader.
-	// handlerHeader is copied into header at WriteHeader
-	// time. Not strictly necessary but ensures consistency with
-	// http.Response
-	handlerHeader       http.Header
-	handlerHeaderCalled bool
-	header              http.Header
-	body                bytes.Buffer
-	statusCode          int
-}
-
-// Header returns the header map that will be sent by
-// WriteHeader. The Header map also is the mechanism with which
-// Handlers can set HTTP trailers.
-//
-// Changing the header map after a call to WriteHeader (or
-// Write) has no effect.
-func (rw *responseWriter) Header() http.Header {
-	rw.handlerHeaderCalled = true
-	return rw.handlerHeader
-}
-
-// we write Status header
-// once WriteHeader is called, further mutations to handlerHeader are ineffective
-
-func (rw *responseWriter) cloneHeader() {
-	h2 := make(http.Header, len(rw.handlerHeader))
-	for k, vv := range rw.handlerHeader {
-		vv2 := make([]string, len(vv))
-		copy(vv2, vv)
-		h2[k] = vv2
+// AsHTTPResponse converts to the equivalent *http.Response, as the load balancer would send it to the client.
+func (resp Response) AsHTTPResponse() (*http.Response, error) {
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode body as base64")
+		}
 	}
-	rw.header = h2
-}
 
-// Write writes Response data.
-//
-// If WriteHeader has not yet been called, Write calls
-// WriteHeader(http.StatusOK) before writing the data. If the Header
-// does not contain a Content-Type line, Write adds a Content-Type set
-// to the result of passing the initial 512 bytes of written data to
-// DetectContentType.
-func (rw *responseWriter) Write(data []byte) (int, error) {
-	if !rw.writeHeaderCalled {
-		rw.WriteHeader(http.StatusOK)
+	var header http.Header
+	if len(resp.MultiValueHeaders) > 0 {
+		header = make(http.Header, len(resp.MultiValueHeaders))
+		for k, vv := range resp.MultiValueHeaders {
+			for _, v := range vv {
+				header.Add(k, v)
+			}
+		}
+	} else {
+		header = resp.Headers.AsHTTPHeader()
 	}
 
-	return rw.body.Write(data)
+	return &http.Response{
+		Status:        statusDescription(resp.StatusCode),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
 }
 
-// WriteHeader sets the Status header with the provided status code.
-// Only one header is set, additional calls are no-op.
-//
-// If WriteHeader is not called explicitly, the first call to Write
-// will trigger an implicit WriteHeader(http.StatusOK).
-// Thus explicit calls to WriteHeader are mainly used to
-// send error codes.
-func (rw *responseWriter) WriteHeader(statusCode int) {
-	if rw.writeHeaderCalled {
-		fmt.Println("multiple WriteHeader calls")
-		return
+// ResponseFromHTTP converts a *http.Response into the equivalent Response, as a lambda function would return it to
+// the load balancer. The body of res is read and closed. There's no request to detect the multi value mode from, single
+// value headers are used unless opts forces multi value headers.
+func ResponseFromHTTP(res *http.Response, opts Options) (Response, error) {
+	if res.StatusCode < 200 || res.StatusCode > 599 {
+		return Response{}, errors.Errorf("invalid status code %d", res.StatusCode)
 	}
-	rw.writeHeaderCalled = true
 
-	// https://github.com/golang/go/blob/a1aafd8b28ada0d40e2cb25fb0762ae171eec558/src/net/http/server.go#L1093
-	if statusCode < 199 || statusCode > 599 {
-		panic(fmt.Sprintf("invalid WriteHeader code %v", statusCode))
+	rw := funcserver.NewResponseRecorder()
+	for k, vv := range res.Header {
+		rw.Header()[k] = append([]string(nil), vv...)
 	}
+	rw.WriteHeader(res.StatusCode)
 
-	if rw.handlerHeaderCalled {
-		rw.cloneHeader()
+	if res.Body != nil {
+		defer res.Body.Close() // nolint: errcheck
+		if _, err := io.Copy(rw, res.Body); err != nil {
+			return Response{}, errors.Wrap(err, "unable to read response body")
+		}
 	}
 
-	rw.statusCode = statusCode
+	return encodeResponse(nil, rw.Result(), opts, opts.multiValue(nil))
 }
 
-// Should return type be a string/[]byte, using interface{} as it's assumed to be a struct with json tags.
-func (rw *responseWriter) AsLambdaResponse() Response {
-	if !rw.writeHeaderCalled {
-		rw.WriteHeader(http.StatusOK)
+// encodeResponse converts res, the response to req (nil if unknown), to a Response within the load balancer's limits.
+func encodeResponse(req *http.Request, res funcserver.RecordedResponse, opts Options, multiValue bool) (Response, error) {
+	resp, err := buildResponse(res, opts, multiValue)
+	if err != nil {
+		return Response{}, err
 	}
+	return limitResponse(req, res, resp, opts, multiValue)
+}
 
+func buildResponse(res funcserver.RecordedResponse, opts Options, multiValue bool) (Response, error) {
 	resp := Response{
-		StatusCode:        rw.statusCode,
-		StatusDescription: http.StatusText(rw.statusCode),
-		Body:              rw.body.String(),
-	}
-
-	// Ensure we've got a Content-Type header
-	bodyLen := len(resp.Body)
-	if bodyLen > 0 && rw.header.Get("Content-Type") == "" {
-		max := 512
-		if bodyLen < max {
-			max = bodyLen
-		}
-		rw.header.Set("Content-Type", http.DetectContentType([]byte(resp.Body[:max])))
+		StatusCode:        res.StatusCode,
+		StatusDescription: statusDescription(res.StatusCode),
 	}
 
 	// multi/single valued Headers
-	if rw.opts.MultiValueHeaders {
-		resp.MultiValueHeaders = rw.header
+	if multiValue {
+		resp.MultiValueHeaders = res.Header
 	} else {
-		resp.Headers = make(Headers)
-		for k := range rw.header {
-			resp.Headers[http.CanonicalHeaderKey(k)] = rw.header.Get(k)
+		var dropped []string
+		resp.Headers, dropped = singleValueHeaders(res.Header, opts.HeaderLoss == CookieCaseVariants)
+		if len(dropped) > 0 {
+			if opts.HeaderLoss == ErrorOnHeaderLoss {
+				return Response{}, errors.Errorf("response headers can't be sent without multi value headers: %s", strings.Join(dropped, ", "))
+			}
+			log.Printf("alblambda: dropped response headers, enable multi value headers to send them: %s", strings.Join(dropped, ", "))
 		}
 	}
 
-	if useB64InResponseBody(rw.header.Get("Content-Type")) {
-		resp.IsBase64Encoded = true
-		resp.Body = base64.StdEncoding.EncodeToString([]byte(resp.Body))
-	}
+	resp.Body, resp.IsBase64Encoded = opts.ContentTypes.EncodeBody(res.Header, res.Body)
+
+	return resp, nil
+}
+
+// HeaderLossPolicy decides what happens when a response can't be sent without losing headers, this can only happen
+// when multi value headers aren't enabled.
+type HeaderLossPolicy int
+
+const (
+	// WarnOnHeaderLoss logs the names of the headers that lost values, the first value of each is sent.
+	WarnOnHeaderLoss HeaderLossPolicy = iota
+	// ErrorOnHeaderLoss fails the invocation rather than send an incomplete response.
+	ErrorOnHeaderLoss
+	// CookieCaseVariants sends repeated Set-Cookie headers with differently cased names (Set-Cookie, set-Cookie,
+	// SEt-Cookie etc), header names are case insensitive so clients treat them as separate headers. That the load
+	// balancer passes on every variant isn't documented, multi value headers are the supported way to send several
+	// cookies. Other headers that lose values are logged as with WarnOnHeaderLoss.
+	CookieCaseVariants
+)
 
-	return resp
+// singletonHeaders are the response headers that can't be combined into a comma separated list.
+// https://www.rfc-editor.org/rfc/rfc9110#section-5.3
+var singletonHeaders = map[string]bool{
+	"Access-Control-Allow-Credentials": true,
+	"Access-Control-Allow-Origin":      true,
+	"Access-Control-Max-Age":           true,
+	"Age":                              true,
+	"Content-Length":                   true,
+	"Content-Location":                 true,
+	"Content-Range":                    true,
+	"Content-Type":                     true,
+	"Date":                             true,
+	"Etag":                             true,
+	"Expires":                          true,
+	"Last-Modified":                    true,
+	"Location":                         true,
+	"Retry-After":                      true,
 }
 
-var notB64 = map[string]bool{
-	"application/json":       true,
-	"application/javascript": true,
-	"application/xml":        true,
+// singleValueHeaders converts h to single value Headers. Repeated headers are combined into a comma separated list
+// where RFC 9110 allows it. Set-Cookie can't be combined, only the first is sent unless caseVariants is set, see
+// CookieCaseVariants. The names of any headers that lost values are returned.
+func singleValueHeaders(h http.Header, caseVariants bool) (Headers, []string) {
+	headers := make(Headers, len(h))
+	var dropped []string
+	for k, vv := range h {
+		if len(vv) == 0 {
+			continue
+		}
+		k = http.CanonicalHeaderKey(k)
+
+		switch {
+		case len(vv) == 1:
+			headers[k] = vv[0]
+		case k == "Set-Cookie" && caseVariants:
+			for i, v := range vv {
+				name, ok := caseVariant(k, i)
+				if !ok {
+					dropped = append(dropped, k)
+					break
+				}
+				headers[name] = v
+			}
+		case k == "Set-Cookie" || singletonHeaders[k]:
+			headers[k] = vv[0]
+			dropped = append(dropped, k)
+		default:
+			headers[k] = strings.Join(vv, ", ")
+		}
+	}
+	sort.Strings(dropped)
+	return headers, dropped
 }
 
-func useB64InResponseBody(contentType string) bool {
-	// this is the test that the alb applies to the request body so it should be
-	// reasonable for the Response
-	if strings.HasPrefix(contentType, "text/") || notB64[contentType] {
-		return false
+// caseVariant returns the nth case variant of name, the case of each letter is flipped according to the bits of n,
+// the 0th variant is name. ok is false if name doesn't have n variants.
+func caseVariant(name string, n int) (variant string, ok bool) {
+	b := []byte(name)
+	for i := range b {
+		if n == 0 {
+			break
+		}
+		c := b[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			continue
+		}
+		if n&1 == 1 {
+			b[i] = c ^ 0x20
+		}
+		n >>= 1
 	}
+	return string(b), n == 0
+}
 
-	return true
+// statusDescription returns the status line sent by the load balancer, eg "200 OK". Codes without a standard reason
+// phrase are described the same way net/http does it.
+func statusDescription(code int) string {
+	text := http.StatusText(code)
+	if text == "" {
+		text = fmt.Sprintf("status code %d", code)
+	}
+	return fmt.Sprintf("%d %s", code, text)
 }
@@ -1,10 +1,17 @@
 package alblambda
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/j0hnsmith/funcserver"
 )
 
 func TestResponse(t *testing.T) { // nolint: gocyclo
@@ -14,16 +21,16 @@ func TestResponse(t *testing.T) { // nolint: gocyclo
 			_, _ = res.Write([]byte(expectedBody))
 		})
 
-		resp := callHandlerReturnResp(t, h, ResponseOptions{})
+		resp := callHandlerReturnResp(t, h, Options{})
 
 		if resp.Body != expectedBody {
 			t.Errorf(`resp.Body = %q, want: "%s"`, resp.Body, expectedBody)
 		}
 		if resp.StatusCode != http.StatusOK {
-			t.Errorf(`resp.StatusCode = %q, want: %d`, resp.StatusCode, http.StatusOK)
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusOK)
 		}
-		if resp.StatusDescription != http.StatusText(http.StatusOK) {
-			t.Errorf(`resp.StatusDescription = %q, want: "%s"`, resp.StatusDescription, http.StatusText(http.StatusOK))
+		if resp.StatusDescription != "200 OK" {
+			t.Errorf(`resp.StatusDescription = %q, want: "%s"`, resp.StatusDescription, "200 OK")
 		}
 	})
 
@@ -37,7 +44,7 @@ func TestResponse(t *testing.T) { // nolint: gocyclo
 			res.Header().Set(key2, value2)
 		})
 
-		resp := callHandlerReturnResp(t, h, ResponseOptions{})
+		resp := callHandlerReturnResp(t, h, Options{})
 
 		if resp.Headers[key1] != value1 {
 			t.Errorf(`resp.Headers[key1] = %q, want: "%s"`, resp.Headers[key1], value1)
@@ -47,6 +54,73 @@ func TestResponse(t *testing.T) { // nolint: gocyclo
 		}
 	})
 
+	t.Run("single value repeated headers", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Add("Cache-Control", "no-cache")
+			res.Header().Add("Cache-Control", "no-store")
+			res.Header().Add("Set-Cookie", "a=1; Path=/")
+			res.Header().Add("Set-Cookie", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+			res.Header().Add("Set-Cookie", "c=3")
+		})
+
+		resp := callHandlerReturnResp(t, h, Options{})
+
+		if resp.Headers["Cache-Control"] != "no-cache, no-store" {
+			t.Errorf(`resp.Headers["Cache-Control"] = %q, want: %q`, resp.Headers["Cache-Control"], "no-cache, no-store")
+		}
+		if len(resp.Headers) != 2 || resp.Headers["Set-Cookie"] != "a=1; Path=/" {
+			t.Errorf(`resp.Headers = %q, want only the first Set-Cookie`, resp.Headers)
+		}
+
+		_, err := WrapHTTPHandler(h, Options{HeaderLoss: ErrorOnHeaderLoss})(context.Background(), albrToMapStringInterface(Request{}))
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("cookie case variants", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Add("Set-Cookie", "a=1; Path=/")
+			res.Header().Add("Set-Cookie", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+			res.Header().Add("Set-Cookie", "c=3")
+		})
+
+		resp := callHandlerReturnResp(t, h, Options{HeaderLoss: CookieCaseVariants})
+
+		want := Headers{"Set-Cookie": "a=1; Path=/", "set-Cookie": "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT", "SEt-Cookie": "c=3"}
+		for k, v := range want {
+			if resp.Headers[k] != v {
+				t.Errorf(`resp.Headers[%q] = %q, want: %q`, k, resp.Headers[k], v)
+			}
+		}
+	})
+
+	t.Run("case variants as http header", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			h := Headers{"Set-Cookie": "a=1", "set-Cookie": "b=2", "SEt-Cookie": "c=3"}.AsHTTPHeader()
+			if !reflect.DeepEqual(h["Set-Cookie"], []string{"b=2"}) {
+				t.Fatalf(`h["Set-Cookie"] = %q, want: %q`, h["Set-Cookie"], []string{"b=2"})
+			}
+		}
+	})
+
+	t.Run("single value header loss", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Add("Location", "/a")
+			res.Header().Add("Location", "/b")
+		})
+
+		resp := callHandlerReturnResp(t, h, Options{})
+		if resp.Headers["Location"] != "/a" {
+			t.Errorf(`resp.Headers["Location"] = %q, want: %q`, resp.Headers["Location"], "/a")
+		}
+
+		_, err := WrapHTTPHandler(h, Options{HeaderLoss: ErrorOnHeaderLoss})(context.Background(), albrToMapStringInterface(Request{}))
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
 	t.Run("multi value header", func(t *testing.T) {
 		key1 := "Some-Header1"
 		values1 := []string{"some value1_1", "some value1_2"}
@@ -57,7 +131,7 @@ func TestResponse(t *testing.T) { // nolint: gocyclo
 			res.Header()[key2] = values2
 		})
 
-		resp := callHandlerReturnResp(t, h, ResponseOptions{MultiValueHeaders: true})
+		resp := callHandlerReturnResp(t, h, Options{MultiValueHeaders: true})
 
 		if len(resp.MultiValueHeaders) != 2 {
 			t.Errorf(`len(resp.MultiValueHeaders) = %d, want: %d`, len(resp.MultiValueHeaders), 2)
@@ -75,6 +149,75 @@ func TestResponse(t *testing.T) { // nolint: gocyclo
 		}
 	})
 
+	t.Run("multi value mode", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("X-Some-Header", "a")
+		})
+		single := Request{Headers: Headers{"accept": "*/*"}}
+		multi := Request{MultiValueHeaders: http.Header{"accept": {"*/*"}}}
+		multiQuery := Request{MultiValueQueryStringParameters: MultiValueQueryStringParameters{}}
+
+		for _, tc := range []struct {
+			name           string
+			albr           Request
+			opts           Options
+			wantMultiValue bool
+		}{
+			{"auto single", single, Options{}, false},
+			{"auto multi", multi, Options{}, true},
+			{"auto multi query", multiQuery, Options{}, true},
+			{"force single", multi, Options{MultiValueMode: ForceSingleValue}, false},
+			{"force multi", single, Options{MultiValueMode: ForceMultiValue}, true},
+			{"MultiValueHeaders", single, Options{MultiValueHeaders: true}, true},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				resp, err := TypedHandler(h, tc.opts)(context.Background(), tc.albr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if gotMultiValue := resp.MultiValueHeaders != nil; gotMultiValue != tc.wantMultiValue || (resp.Headers != nil) == tc.wantMultiValue {
+					t.Errorf(`resp.MultiValueHeaders = %v, resp.Headers = %v, want multi value: %t`, resp.MultiValueHeaders, resp.Headers, tc.wantMultiValue)
+				}
+			})
+		}
+	})
+
+	t.Run("content types", func(t *testing.T) {
+		for _, tc := range []struct {
+			contentType         string
+			opts                Options
+			expectBase64Encoded bool
+		}{
+			{"application/problem+json", Options{}, false},
+			{"application/json; charset=utf-8", Options{}, false},
+			{"application/vnd.custom", Options{}, true},
+			{"application/vnd.custom", Options{ContentTypes: funcserver.ContentClassifier{Text: []string{"application/vnd.custom"}}}, false},
+		} {
+			h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.Header().Set("Content-Type", tc.contentType)
+				_, _ = res.Write([]byte(`{"a":1}`))
+			})
+
+			resp := callHandlerReturnResp(t, h, tc.opts)
+			if resp.IsBase64Encoded != tc.expectBase64Encoded {
+				t.Errorf(`%s: resp.IsBase64Encoded = %t, want: %t`, tc.contentType, resp.IsBase64Encoded, tc.expectBase64Encoded)
+			}
+		}
+	})
+
+	t.Run("empty body without content type", func(t *testing.T) {
+		for _, status := range []int{http.StatusNoContent, http.StatusNotModified, http.StatusFound} {
+			h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(status)
+			})
+
+			resp := callHandlerReturnResp(t, h, Options{})
+			if resp.IsBase64Encoded || resp.Body != "" {
+				t.Errorf(`%d: resp.IsBase64Encoded, resp.Body = %t, %q, want: false, ""`, status, resp.IsBase64Encoded, resp.Body)
+			}
+		}
+	})
+
 	t.Run("body encoding & detected content type", func(t *testing.T) {
 		bodyTests := []struct {
 			name                string
@@ -109,7 +252,7 @@ func TestResponse(t *testing.T) { // nolint: gocyclo
 					_, _ = res.Write(body)
 				})
 
-				resp := callHandlerReturnResp(t, h, ResponseOptions{})
+				resp := callHandlerReturnResp(t, h, Options{})
 
 				if resp.Body != tc.body {
 					t.Errorf(`resp.Body = %q, want: %q`, resp.Body, tc.body)
@@ -125,10 +268,96 @@ func TestResponse(t *testing.T) { // nolint: gocyclo
 	})
 }
 
-func callHandlerReturnResp(t *testing.T, h http.Handler, opts ResponseOptions) Response {
+func TestResponseHTTPConversion(t *testing.T) {
+	t.Run("AsHTTPResponse", func(t *testing.T) {
+		resp := Response{
+			StatusCode:        http.StatusNotFound,
+			StatusDescription: "404 Not Found",
+			MultiValueHeaders: http.Header{"set-cookie": {"a=1", "b=2"}},
+			IsBase64Encoded:   true,
+			Body:              "AAEC",
+		}
+
+		res, err := resp.AsHTTPResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusNotFound || res.Status != "404 Not Found" {
+			t.Errorf(`res.Status = %q, want: %q`, res.Status, "404 Not Found")
+		}
+		if !reflect.DeepEqual(res.Header["Set-Cookie"], []string{"a=1", "b=2"}) {
+			t.Errorf(`res.Header["Set-Cookie"] = %q, want: %q`, res.Header["Set-Cookie"], []string{"a=1", "b=2"})
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		if !bytes.Equal(body, []byte{0, 1, 2}) || res.ContentLength != 3 {
+			t.Errorf(`body = %v (length %d), want: %v (length 3)`, body, res.ContentLength, []byte{0, 1, 2})
+		}
+	})
+
+	t.Run("ResponseFromHTTP", func(t *testing.T) {
+		res := &http.Response{
+			StatusCode: http.StatusCreated,
+			Header:     http.Header{"Content-Type": {"text/plain"}, "X-Some-Header": {"a", "b"}},
+			Body:       ioutil.NopCloser(strings.NewReader("created")),
+		}
+
+		resp, err := ResponseFromHTTP(res, Options{MultiValueHeaders: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusCreated {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusCreated)
+		}
+		if !reflect.DeepEqual(resp.MultiValueHeaders["X-Some-Header"], []string{"a", "b"}) {
+			t.Errorf(`resp.MultiValueHeaders["X-Some-Header"] = %q, want: %q`, resp.MultiValueHeaders["X-Some-Header"], []string{"a", "b"})
+		}
+		if resp.Body != "created" || resp.IsBase64Encoded {
+			t.Errorf(`resp.Body = %q (b64 %t), want: %q (b64 false)`, resp.Body, resp.IsBase64Encoded, "created")
+		}
+	})
+
+	t.Run("ResponseFromHTTP invalid status", func(t *testing.T) {
+		_, err := ResponseFromHTTP(&http.Response{StatusCode: 999}, Options{})
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "image/png")
+			res.WriteHeader(http.StatusAccepted)
+			_, _ = res.Write([]byte{0, 1, 2})
+		})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		resp, err := ResponseFromHTTP(rec.Result(), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := resp.AsHTTPResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusAccepted {
+			t.Errorf(`res.StatusCode = %d, want: %d`, res.StatusCode, http.StatusAccepted)
+		}
+		if res.Header.Get("Content-Type") != "image/png" {
+			t.Errorf(`res.Header.Get("Content-Type") = %q, want: %q`, res.Header.Get("Content-Type"), "image/png")
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		if !bytes.Equal(body, []byte{0, 1, 2}) {
+			t.Errorf(`body = %v, want: %v`, body, []byte{0, 1, 2})
+		}
+	})
+}
+
+func callHandlerReturnResp(t *testing.T, h http.Handler, opts Options) Response {
 	f := WrapHTTPHandler(h, opts)
 
-	albr := aLBRequest{}
+	albr := Request{}
 	r, err := f(context.Background(), albrToMapStringInterface(albr))
 	if err != nil {
 		t.Error(err)
@@ -2,16 +2,24 @@ package alblambda
 
 import (
 	"net/http"
+	"sort"
 )
 
 // Headers is a container for single value HTTP Headers.
 type Headers map[string]string
 
-// AsHTTPHeader converts to a http.Header
+// AsHTTPHeader converts to a http.Header. Names are canonicalised, so of names that only differ by case (eg the
+// Set-Cookie variants of a single value response) only one is kept, the value of the last in sort order.
 func (h Headers) AsHTTPHeader() http.Header {
-	out := make(http.Header)
-	for k, v := range h {
-		out.Set(k, v)
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(http.Header, len(h))
+	for _, k := range keys {
+		out.Set(k, h[k])
 	}
 	return out
 }
@@ -0,0 +1,114 @@
+/*
+Package apigwlambda provides a conversion wrapper so that a http.Handler can be used in an AWS lambda function that
+is invoked by an API Gateway REST API using a lambda proxy integration (the v1 payload format).
+
+API Gateway sends the incoming request to the lambda function as a json payload, this package turns that payload into
+a http.Request, calls your http.Handler with it and an appropriate http.ResponseWriter, then returns the response in the
+shape API Gateway expects.
+
+Here's some background info
+https://docs.aws.amazon.com/apigateway/latest/developerguide/set-up-lambda-proxy-integrations.html.
+
+Paths:
+
+API Gateway includes the stage in requestContext.path but not in path when the default execute-api endpoint is used.
+When the API is served from a custom domain with a base path mapping, the base path is included in path, set
+Options.BasePath to strip it so that your router sees the same paths wherever the API is mounted. Options.StripStage
+strips a leading /{stage} segment for setups that forward the stage as part of the path.
+
+Path parameters, stage variables and the authorizer context are available to handlers via PathParameter,
+PathParameters, StageVariables and AuthorizerFromContext.
+
+Caveats:
+
+- request & response payloads are limited to 6mb and 10mb respectively, the integration times out after 29 seconds
+
+- no streaming requests/responses, request is received in full before the lambda is invoked, handler must return before
+response is sent to API Gateway
+
+- binary responses are only passed through as binary if the content type is listed in the API's binary media types
+
+Example usage:
+
+	package main
+
+	import (
+		"net/http"
+
+		"github.com/gorilla/mux"
+		"github.com/j0hnsmith/funcserver/apigwlambda"
+		"github.com/j0hnsmith/funcserver/lambdaruntime"
+	)
+
+	func main() {
+		router := mux.NewRouter()
+		router.HandleFunc("/", func(resp http.ResponseWriter, req *http.Request) { resp.Write([]byte("<h1>Home</h1>")) })
+		router.HandleFunc("/products/{id}", func(resp http.ResponseWriter, req *http.Request) {
+			resp.Write([]byte(apigwlambda.PathParameter(req.Context(), "id")))
+		})
+
+		// wrap handler to automatically convert requests/responses, api is mounted at https://api.example.com/v1
+		lambdaruntime.Start(apigwlambda.WrapHTTPHandler(router, apigwlambda.Options{BasePath: "/v1"}))
+	}
+*/
+package apigwlambda
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Options holds the options for converting requests & responses.
+type Options struct {
+	funcserver.Options
+
+	// BasePath is the base path of a custom domain name mapping (eg "/v1"), it is stripped from the start of the
+	// request path before the handler is called.
+	// https://docs.aws.amazon.com/apigateway/latest/developerguide/rest-api-mappings.html
+	BasePath string
+
+	// StripStage removes a leading /{stage} segment from the request path.
+	StripStage bool
+
+	// ContentTypes decides which response bodies are binary & so base64 encoded.
+	ContentTypes funcserver.ContentClassifier
+}
+
+// WrapHTTPHandler is wrapper around a http.Handler to convert requests & responses for use in a AWS Lambda function
+// with requests coming from an API Gateway REST API lambda proxy integration. It's the untyped form of TypedHandler.
+func WrapHTTPHandler(h http.Handler, opts Options) funcserver.RequestHandler {
+	return funcserver.Untyped(TypedHandler(h, opts))
+}
+
+// TypedHandler is the same as WrapHTTPHandler but the handler receives a Request and returns a Response. It
+// implements the lambdaruntime.Handler interface, the payload is decoded straight into a Request.
+func TypedHandler(h http.Handler, opts Options) funcserver.Handler[Request, Response] {
+	return funcserver.WrapWithOptions[Request, Response](NewAdapter(opts), h, opts.Options)
+}
+
+// Adapter converts events to requests and responses to events, it implements funcserver.Adapter.
+type Adapter struct {
+	opts Options
+}
+
+// NewAdapter returns an Adapter that converts requests according to opts.
+func NewAdapter(opts Options) Adapter {
+	return Adapter{opts: opts}
+}
+
+// DecodeRequest converts apigwr to a *http.Request, stripping the path according to the options.
+func (a Adapter) DecodeRequest(ctx context.Context, apigwr Request) (*http.Request, error) {
+	req, err := apigwr.AsHTTPRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Path = a.opts.stripPath(req.URL.Path, apigwr.RequestContext.Stage)
+	return req, nil
+}
+
+// EncodeResponse converts a recorded response to a Response.
+func (a Adapter) EncodeResponse(req *http.Request, res funcserver.RecordedResponse) (Response, error) {
+	return encodeResponse(res, a.opts), nil
+}
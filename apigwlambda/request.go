@@ -0,0 +1,208 @@
+package apigwlambda
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Request represents an http request received by an API Gateway REST API and forwarded to a lambda function via a
+// proxy integration. It's container to marshal json into that can be converted to a *http.Request.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/set-up-lambda-proxy-integrations.html#api-gateway-simple-proxy-for-lambda-input-format
+type Request struct {
+	Resource                        string              `json:"resource"`
+	Path                            string              `json:"path"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Headers                         map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders               http.Header         `json:"multiValueHeaders,omitempty"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters,omitempty"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters,omitempty"`
+	PathParameters                  map[string]string   `json:"pathParameters,omitempty"`
+	StageVariables                  map[string]string   `json:"stageVariables,omitempty"`
+	RequestContext                  RequestContext      `json:"requestContext"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+	Body                            string              `json:"body"`
+}
+
+var _ funcserver.RequestConverter = Request{}
+
+// contextKey is the type of the context keys private to this package.
+type contextKey int
+
+const (
+	requestContextKey contextKey = iota
+	pathParametersContextKey
+	stageVariablesContextKey
+)
+
+// RequestContext holds information about the API Gateway request. This is accessed via
+// RequestContextFromContext.
+type RequestContext struct {
+	AccountID         string     `json:"accountId"`
+	APIID             string     `json:"apiId"`
+	Authorizer        Authorizer `json:"authorizer,omitempty"`
+	DomainName        string     `json:"domainName"`
+	DomainPrefix      string     `json:"domainPrefix"`
+	ExtendedRequestID string     `json:"extendedRequestId"`
+	HTTPMethod        string     `json:"httpMethod"`
+	Identity          Identity   `json:"identity"`
+	Path              string     `json:"path"`
+	Protocol          string     `json:"protocol"`
+	RequestID         string     `json:"requestId"`
+	RequestTime       string     `json:"requestTime"`
+	RequestTimeEpoch  int64      `json:"requestTimeEpoch"`
+	ResourceID        string     `json:"resourceId"`
+	ResourcePath      string     `json:"resourcePath"`
+	Stage             string     `json:"stage"`
+}
+
+// Identity holds information about the caller.
+type Identity struct {
+	AccessKey                     string `json:"accessKey"`
+	AccountID                     string `json:"accountId"`
+	APIKey                        string `json:"apiKey"`
+	APIKeyID                      string `json:"apiKeyId"`
+	Caller                        string `json:"caller"`
+	CognitoAuthenticationProvider string `json:"cognitoAuthenticationProvider"`
+	CognitoAuthenticationType     string `json:"cognitoAuthenticationType"`
+	CognitoIdentityID             string `json:"cognitoIdentityId"`
+	CognitoIdentityPoolID         string `json:"cognitoIdentityPoolId"`
+	PrincipalOrgID                string `json:"principalOrgId"`
+	SourceIP                      string `json:"sourceIp"`
+	User                          string `json:"user"`
+	UserAgent                     string `json:"userAgent"`
+	UserArn                       string `json:"userArn"`
+}
+
+// Authorizer holds the context returned by a lambda authorizer, or the claims of a cognito user pool authorizer.
+type Authorizer map[string]interface{}
+
+// PrincipalID returns the principal id returned by a lambda authorizer.
+func (a Authorizer) PrincipalID() string {
+	return a.String("principalId")
+}
+
+// String returns the value of a lambda authorizer context key as a string, "" if the key doesn't exist or the value
+// isn't a string.
+func (a Authorizer) String(key string) string {
+	s, _ := a[key].(string)
+	return s
+}
+
+// Claims returns the claims of a cognito user pool authorizer, nil if there are none.
+func (a Authorizer) Claims() map[string]interface{} {
+	c, _ := a["claims"].(map[string]interface{})
+	return c
+}
+
+// AsHTTPRequest converts to the equivalent *http.Request so that the request can be processed via standard net/http
+// functionality.
+func (apigwr Request) AsHTTPRequest(ctx context.Context) (*http.Request, error) {
+	qp := make(url.Values)
+	if len(apigwr.MultiValueQueryStringParameters) > 0 {
+		for k, vv := range apigwr.MultiValueQueryStringParameters {
+			qp[k] = append(qp[k], vv...)
+		}
+	} else {
+		for k, v := range apigwr.QueryStringParameters {
+			qp.Set(k, v)
+		}
+	}
+
+	headers := make(http.Header)
+	if len(apigwr.MultiValueHeaders) > 0 {
+		for k, vv := range apigwr.MultiValueHeaders {
+			for _, v := range vv {
+				headers.Add(k, v)
+			}
+		}
+	} else {
+		for k, v := range apigwr.Headers {
+			headers.Set(k, v)
+		}
+	}
+
+	bodyStr, bodyErr := funcserver.DecodeBody(apigwr.Body, apigwr.IsBase64Encoded)
+
+	// as with net/http.Server the Host header is removed
+	host := headers.Get("Host")
+	headers.Del("Host")
+	if host == "" {
+		host = apigwr.RequestContext.DomainName
+	}
+
+	r := &http.Request{
+		Method: apigwr.HTTPMethod,
+		URL: &url.URL{
+			Path:     apigwr.Path,
+			RawQuery: qp.Encode(),
+		},
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Host:          host,
+		ContentLength: int64(len(bodyStr)),
+		Body:          ioutil.NopCloser(strings.NewReader(bodyStr)),
+	}
+	// api gateway only accepts https
+	sourceIP, _ := netip.ParseAddr(apigwr.RequestContext.Identity.SourceIP)
+	funcserver.SetServerFields(r, "https", sourceIP)
+
+	ctx = context.WithValue(ctx, requestContextKey, apigwr.RequestContext)
+	ctx = context.WithValue(ctx, pathParametersContextKey, apigwr.PathParameters)
+	ctx = context.WithValue(ctx, stageVariablesContextKey, apigwr.StageVariables)
+	r = r.WithContext(ctx)
+
+	if bodyErr != nil {
+		return nil, &funcserver.RequestError{Request: r, Err: bodyErr}
+	}
+	return r, nil
+}
+
+// stripPath removes the stage and/or the base path from the start of p according to opts.
+func (opts Options) stripPath(p, stage string) string {
+	if opts.StripStage && stage != "" {
+		p = funcserver.StripPathPrefix(p, "/"+stage)
+	}
+	if base := strings.Trim(opts.BasePath, "/"); base != "" {
+		p = funcserver.StripPathPrefix(p, "/"+base)
+	}
+	return p
+}
+
+// RequestContextFromContext returns the API Gateway request context of the request.
+func RequestContextFromContext(ctx context.Context) (RequestContext, bool) {
+	rc, ok := ctx.Value(requestContextKey).(RequestContext)
+	return rc, ok
+}
+
+// AuthorizerFromContext returns the authorizer context of the request, ok is false if the request wasn't authorized
+// by a lambda or cognito user pool authorizer.
+func AuthorizerFromContext(ctx context.Context) (a Authorizer, ok bool) {
+	rc, _ := RequestContextFromContext(ctx)
+	return rc.Authorizer, len(rc.Authorizer) > 0
+}
+
+// PathParameters returns the path parameters API Gateway matched against the resource path, eg {"id": "123"} for a
+// resource /products/{id}.
+func PathParameters(ctx context.Context) map[string]string {
+	pp, _ := ctx.Value(pathParametersContextKey).(map[string]string)
+	return pp
+}
+
+// PathParameter returns the named path parameter, "" if it doesn't exist.
+func PathParameter(ctx context.Context, name string) string {
+	return PathParameters(ctx)[name]
+}
+
+// StageVariables returns the stage variables of the stage that received the request.
+func StageVariables(ctx context.Context) map[string]string {
+	sv, _ := ctx.Value(stageVariablesContextKey).(map[string]string)
+	return sv
+}
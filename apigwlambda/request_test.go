@@ -0,0 +1,270 @@
+package apigwlambda
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRequest(t *testing.T) { // nolint: gocyclo
+	t.Run("method & path", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodPost {
+				t.Errorf(`req.Method = %q, want: %q`, req.Method, http.MethodPost)
+			}
+			if req.URL.Path != "/products/123" {
+				t.Errorf(`req.URL.Path = %q, want: %q`, req.URL.Path, "/products/123")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		apigwr := Request{HTTPMethod: http.MethodPost, Path: "/products/123"}
+		_, err := f(context.Background(), apigwrToMapStringInterface(apigwr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("path stripping", func(t *testing.T) {
+		pathTests := []struct {
+			name         string
+			path         string
+			stage        string
+			opts         Options
+			expectedPath string
+		}{
+			{
+				name:         "no options",
+				path:         "/v1/products",
+				stage:        "prod",
+				expectedPath: "/v1/products",
+			},
+			{
+				name:         "base path",
+				path:         "/v1/products",
+				opts:         Options{BasePath: "/v1"},
+				expectedPath: "/products",
+			},
+			{
+				name:         "base path without slashes",
+				path:         "/v1/products",
+				opts:         Options{BasePath: "v1"},
+				expectedPath: "/products",
+			},
+			{
+				name:         "base path root",
+				path:         "/v1",
+				opts:         Options{BasePath: "/v1/"},
+				expectedPath: "/",
+			},
+			{
+				name:         "base path partial segment",
+				path:         "/v10/products",
+				opts:         Options{BasePath: "/v1"},
+				expectedPath: "/v10/products",
+			},
+			{
+				name:         "stage",
+				path:         "/prod/products",
+				stage:        "prod",
+				opts:         Options{StripStage: true},
+				expectedPath: "/products",
+			},
+			{
+				name:         "stage & base path",
+				path:         "/v1/prod/products",
+				stage:        "prod",
+				opts:         Options{StripStage: true, BasePath: "/v1"},
+				expectedPath: "/prod/products",
+			},
+		}
+
+		for _, tc := range pathTests {
+			t.Run(tc.name, func(t *testing.T) {
+				h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					if req.URL.Path != tc.expectedPath {
+						t.Errorf(`req.URL.Path = %q, want: %q`, req.URL.Path, tc.expectedPath)
+					}
+				})
+
+				f := WrapHTTPHandler(h, tc.opts)
+				apigwr := Request{Path: tc.path, RequestContext: RequestContext{Stage: tc.stage}}
+				_, err := f(context.Background(), apigwrToMapStringInterface(apigwr))
+				if err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	})
+
+	t.Run("query params", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			vals := req.URL.Query()
+			if !reflect.DeepEqual(vals["a"], []string{"1", "2"}) {
+				t.Errorf(`vals["a"] = %q, want: %q`, vals["a"], []string{"1", "2"})
+			}
+			if vals.Get("b") != "x&y=z" {
+				t.Errorf(`vals.Get("b") = %q, want: %q`, vals.Get("b"), "x&y=z")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		apigwr := Request{
+			QueryStringParameters:           map[string]string{"a": "2", "b": "x&y=z"},
+			MultiValueQueryStringParameters: map[string][]string{"a": {"1", "2"}, "b": {"x&y=z"}},
+		}
+		_, err := f(context.Background(), apigwrToMapStringInterface(apigwr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("headers, host & server fields", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if !reflect.DeepEqual(req.Header["Cookie"], []string{"a=1", "b=2"}) {
+				t.Errorf(`req.Header["Cookie"] = %q, want: %q`, req.Header["Cookie"], []string{"a=1", "b=2"})
+			}
+			if req.Host != "api.example.com" {
+				t.Errorf(`req.Host = %q, want: %q`, req.Host, "api.example.com")
+			}
+			if req.RemoteAddr != "192.0.2.1:0" {
+				t.Errorf(`req.RemoteAddr = %q, want: %q`, req.RemoteAddr, "192.0.2.1:0")
+			}
+			if req.RequestURI != "/a%20b" {
+				t.Errorf(`req.RequestURI = %q, want: %q`, req.RequestURI, "/a%20b")
+			}
+			if req.URL.String() != "https://api.example.com/a%20b" {
+				t.Errorf(`req.URL = %q, want: %q`, req.URL.String(), "https://api.example.com/a%20b")
+			}
+			if req.TLS == nil || req.TLS.ServerName != "api.example.com" {
+				t.Errorf(`req.TLS = %v, want: ServerName %q`, req.TLS, "api.example.com")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		apigwr := Request{
+			Path:              "/a b",
+			Headers:           map[string]string{"cookie": "b=2"},
+			MultiValueHeaders: http.Header{"cookie": {"a=1", "b=2"}},
+			RequestContext: RequestContext{
+				DomainName: "api.example.com",
+				Identity:   Identity{SourceIP: "192.0.2.1"},
+			},
+		}
+		_, err := f(context.Background(), apigwrToMapStringInterface(apigwr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("body", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(body) != "request body" {
+				t.Errorf(`body = %q, want: %q`, body, "request body")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		apigwr := Request{Body: "cmVxdWVzdCBib2R5", IsBase64Encoded: true}
+		_, err := f(context.Background(), apigwrToMapStringInterface(apigwr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("context accessors", func(t *testing.T) {
+		apigwr := Request{
+			PathParameters: map[string]string{"id": "123"},
+			StageVariables: map[string]string{"env": "prod"},
+			RequestContext: RequestContext{
+				RequestID: "c6af9ac6-7b61-11e6-9a41-93e8deadbeef",
+				Authorizer: Authorizer{
+					"principalId": "user|a1b2c3d4",
+					"tenant":      "acme",
+					"claims":      map[string]interface{}{"email": "user@example.com"},
+				},
+			},
+		}
+
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			if id := PathParameter(ctx, "id"); id != "123" {
+				t.Errorf(`PathParameter(ctx, "id") = %q, want: %q`, id, "123")
+			}
+			if env := StageVariables(ctx)["env"]; env != "prod" {
+				t.Errorf(`StageVariables(ctx)["env"] = %q, want: %q`, env, "prod")
+			}
+			rc, ok := RequestContextFromContext(ctx)
+			if !ok || rc.RequestID != apigwr.RequestContext.RequestID {
+				t.Errorf(`rc.RequestID = %q, want: %q`, rc.RequestID, apigwr.RequestContext.RequestID)
+			}
+			a, ok := AuthorizerFromContext(ctx)
+			if !ok {
+				t.Fatal("AuthorizerFromContext(ctx) ok = false, want: true")
+			}
+			if a.PrincipalID() != "user|a1b2c3d4" {
+				t.Errorf(`a.PrincipalID() = %q, want: %q`, a.PrincipalID(), "user|a1b2c3d4")
+			}
+			if a.String("tenant") != "acme" {
+				t.Errorf(`a.String("tenant") = %q, want: %q`, a.String("tenant"), "acme")
+			}
+			if a.Claims()["email"] != "user@example.com" {
+				t.Errorf(`a.Claims()["email"] = %q, want: %q`, a.Claims()["email"], "user@example.com")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		_, err := f(context.Background(), apigwrToMapStringInterface(apigwr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("no authorizer", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if _, ok := AuthorizerFromContext(req.Context()); ok {
+				t.Error("AuthorizerFromContext(ctx) ok = true, want: false")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		_, err := f(context.Background(), apigwrToMapStringInterface(Request{}))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("req body encoding error", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+
+		f := WrapHTTPHandler(h, Options{})
+		apigwr := Request{Body: "not base64", IsBase64Encoded: true}
+		_, err := f(context.Background(), apigwrToMapStringInterface(apigwr))
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func apigwrToMapStringInterface(apigwr Request) map[string]interface{} {
+	data, err := json.Marshal(apigwr)
+	if err != nil {
+		panic("unable to marshal Request")
+	}
+
+	m := make(map[string]interface{})
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		panic("unable to unmarshal into map[string]interface{}")
+	}
+
+	return m
+}
@@ -0,0 +1,31 @@
+package apigwlambda
+
+import (
+	"net/http"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Response represents a response sent to API Gateway.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/set-up-lambda-proxy-integrations.html#api-gateway-simple-proxy-for-lambda-output-format
+type Response struct {
+	IsBase64Encoded   bool              `json:"isBase64Encoded"`
+	StatusCode        int               `json:"statusCode"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	MultiValueHeaders http.Header       `json:"multiValueHeaders,omitempty"`
+	Body              string            `json:"body"`
+}
+
+// encodeResponse converts a recorded response to a Response. API Gateway REST APIs always accept multi value headers so
+// they're used in preference to single value headers, this means repeated headers such as Set-Cookie survive the
+// conversion.
+func encodeResponse(res funcserver.RecordedResponse, opts Options) Response {
+	resp := Response{
+		StatusCode:        res.StatusCode,
+		MultiValueHeaders: res.Header,
+	}
+
+	resp.Body, resp.IsBase64Encoded = opts.ContentTypes.EncodeBody(res.Header, res.Body)
+
+	return resp
+}
@@ -0,0 +1,72 @@
+package apigwlambda
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestResponse(t *testing.T) {
+	t.Run("body & default status", func(t *testing.T) {
+		expectedBody := "Hello World!"
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte(expectedBody))
+		})
+
+		resp := callHandlerReturnResp(t, h)
+
+		if resp.Body != expectedBody {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, expectedBody)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusOK)
+		}
+		if resp.IsBase64Encoded {
+			t.Error("resp.IsBase64Encoded = true, want: false")
+		}
+	})
+
+	t.Run("status & repeated headers", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			http.SetCookie(res, &http.Cookie{Name: "a", Value: "1"})
+			http.SetCookie(res, &http.Cookie{Name: "b", Value: "2"})
+			res.WriteHeader(http.StatusCreated)
+		})
+
+		resp := callHandlerReturnResp(t, h)
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusCreated)
+		}
+		if !reflect.DeepEqual(resp.MultiValueHeaders["Set-Cookie"], []string{"a=1", "b=2"}) {
+			t.Errorf(`resp.MultiValueHeaders["Set-Cookie"] = %q, want: %q`, resp.MultiValueHeaders["Set-Cookie"], []string{"a=1", "b=2"})
+		}
+	})
+
+	t.Run("binary body b64 encoded", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = res.Write([]byte{0, 1, 2})
+		})
+
+		resp := callHandlerReturnResp(t, h)
+
+		if !resp.IsBase64Encoded {
+			t.Error("resp.IsBase64Encoded = false, want: true")
+		}
+		if resp.Body != "AAEC" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "AAEC")
+		}
+	})
+}
+
+func callHandlerReturnResp(t *testing.T, h http.Handler) Response {
+	f := WrapHTTPHandler(h, Options{})
+
+	r, err := f(context.Background(), apigwrToMapStringInterface(Request{}))
+	if err != nil {
+		t.Error(err)
+	}
+	return r.(Response)
+}
@@ -4,9 +4,9 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/gorilla/mux"
 	"github.com/j0hnsmith/funcserver/alblambda"
+	"github.com/j0hnsmith/funcserver/lambdaruntime"
 )
 
 // main is run by AWS Lambda.
@@ -14,7 +14,7 @@ func main() {
 	router := Router()
 
 	// wrap handler to automatically convert requests/responses
-	lambda.Start(alblambda.WrapHTTPHandler(router, alblambda.ResponseOptions{}))
+	lambdaruntime.StartHandler(alblambda.NewHandler(router, alblambda.Options{}))
 }
 
 // func main1() {
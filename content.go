@@ -0,0 +1,98 @@
+package funcserver
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// textTypes are the media types, other than text/*, +json & +xml, that are text.
+var textTypes = map[string]bool{
+	"application/ecmascript":            true,
+	"application/graphql":               true,
+	"application/javascript":            true,
+	"application/json":                  true,
+	"application/x-javascript":          true,
+	"application/x-ndjson":              true,
+	"application/x-www-form-urlencoded": true,
+	"application/xml":                   true,
+	"application/yaml":                  true,
+}
+
+// ContentClassifier decides whether bodies are text or binary, binary bodies must be base64 encoded to be sent in a
+// json event. The zero value treats text/*, json, xml (including +json & +xml types such as application/problem+json &
+// image/svg+xml), javascript, yaml & form bodies as text.
+type ContentClassifier struct {
+	// Text are extra media types that are text, eg "application/vnd.custom" or "font/*".
+	Text []string
+
+	// Binary are media types that are binary even though they'd otherwise be text, it takes precedence over Text.
+	Binary []string
+
+	// IsBinaryFunc, if set, is used instead of the rules above. It's called with the unparsed Content-Type header.
+	IsBinaryFunc func(contentType string) bool
+}
+
+// IsBinary reports whether a body with the given Content-Type header is binary. Parameters (eg charset) are ignored,
+// a body without a content type is binary.
+func (c ContentClassifier) IsBinary(contentType string) bool {
+	if c.IsBinaryFunc != nil {
+		return c.IsBinaryFunc(contentType)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	if mediaType == "" {
+		return true
+	}
+
+	switch {
+	case matchMediaType(mediaType, c.Binary):
+		return true
+	case matchMediaType(mediaType, c.Text),
+		strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"),
+		textTypes[mediaType]:
+		return false
+	}
+	return true
+}
+
+// Base64 reports whether a body with the headers h must be base64 encoded, either it's binary or it has a content
+// encoding (eg gzip).
+func (c ContentClassifier) Base64(h http.Header) bool {
+	if ce := h.Get("Content-Encoding"); ce != "" && !strings.EqualFold(ce, "identity") {
+		return true
+	}
+	return c.IsBinary(h.Get("Content-Type"))
+}
+
+// EncodeBody returns body as the body of a json event & whether it's base64 encoded, see Base64. A body without a
+// content type (ie an empty body) isn't encoded.
+func (c ContentClassifier) EncodeBody(h http.Header, body []byte) (string, bool) {
+	if h.Get("Content-Type") == "" || !c.Base64(h) {
+		return string(body), false
+	}
+	return base64.StdEncoding.EncodeToString(body), true
+}
+
+// matchMediaType reports whether mediaType matches one of types, a type can be a wildcard such as "font/*".
+func matchMediaType(mediaType string, types []string) bool {
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// UseBase64 reports whether a body with the given content type must be base64 encoded to be sent in a json event,
+// using the default ContentClassifier.
+func UseBase64(contentType string) bool {
+	return ContentClassifier{}.IsBinary(contentType)
+}
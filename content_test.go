@@ -0,0 +1,86 @@
+package funcserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestContentClassifier(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		for ct, want := range map[string]bool{
+			"text/html; charset=utf-8":                  false,
+			"application/json":                          false,
+			"application/json; charset=utf-8":           false,
+			"Application/JSON":                          false,
+			"application/problem+json":                  false,
+			"application/graphql-response+json":         false,
+			"image/svg+xml":                             false,
+			"application/x-www-form-urlencoded":         false,
+			"image/png":                                 true,
+			"application/octet-stream":                  true,
+			"application/pdf; name=\"report.pdf\"":      true,
+			"":                                          true,
+			"not a ; valid = media type; charset=utf-8": true,
+		} {
+			if got := (ContentClassifier{}).IsBinary(ct); got != want {
+				t.Errorf(`IsBinary(%q) = %t, want: %t`, ct, got, want)
+			}
+			if got := UseBase64(ct); got != want {
+				t.Errorf(`UseBase64(%q) = %t, want: %t`, ct, got, want)
+			}
+		}
+	})
+
+	t.Run("extra types", func(t *testing.T) {
+		c := ContentClassifier{
+			Text:   []string{"application/vnd.custom", "font/*"},
+			Binary: []string{"text/x-binary"},
+		}
+		for ct, want := range map[string]bool{
+			"application/vnd.custom; v=1": false,
+			"font/woff2":                  false,
+			"text/x-binary":               true,
+			"text/plain":                  false,
+		} {
+			if got := c.IsBinary(ct); got != want {
+				t.Errorf(`IsBinary(%q) = %t, want: %t`, ct, got, want)
+			}
+		}
+	})
+
+	t.Run("IsBinaryFunc", func(t *testing.T) {
+		c := ContentClassifier{IsBinaryFunc: func(contentType string) bool { return contentType == "text/plain" }}
+		if !c.IsBinary("text/plain") || c.IsBinary("image/png") {
+			t.Error("IsBinaryFunc not used")
+		}
+	})
+
+	t.Run("Base64 content encoding", func(t *testing.T) {
+		h := http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"gzip"}}
+		if !(ContentClassifier{}).Base64(h) {
+			t.Errorf(`Base64(%v) = false, want: true`, h)
+		}
+		h.Set("Content-Encoding", "identity")
+		if (ContentClassifier{}).Base64(h) {
+			t.Errorf(`Base64(%v) = true, want: false`, h)
+		}
+	})
+
+	t.Run("EncodeBody", func(t *testing.T) {
+		for _, tc := range []struct {
+			contentType string
+			wantBody    string
+			wantBase64  bool
+		}{
+			{"text/plain", "body", false},
+			{"image/png", "Ym9keQ==", true},
+			{"", "body", false},
+		} {
+			h := http.Header{"Content-Type": {tc.contentType}}
+			body, isBase64 := (ContentClassifier{}).EncodeBody(h, []byte("body"))
+			if body != tc.wantBody || isBase64 != tc.wantBase64 {
+				t.Errorf(`EncodeBody(%q) = %q, %t, want: %q, %t`, tc.contentType, body, isBase64, tc.wantBody, tc.wantBase64)
+			}
+		}
+	})
+}
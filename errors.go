@@ -0,0 +1,64 @@
+package funcserver
+
+import (
+	"errors"
+	"net/http"
+)
+
+// EventError is returned when a payload can't be unmarshalled into an event, eg it's not json or it's a different
+// event type. It's not caused by the client's request, lambda (or a misconfiguration) sent an event the function can't
+// handle, so there's no request to respond to and the invocation fails.
+type EventError struct {
+	Err error
+}
+
+func (e *EventError) Error() string {
+	return "unable to unmarshal payload: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error. There's deliberately no Cause method, errors.Cause stops at the EventError.
+func (e *EventError) Unwrap() error {
+	return e.Err
+}
+
+// RequestError is returned by an Adapter when an event can't be converted into a request because of the client's
+// input, eg a body that isn't valid base64. See Options.RespondToBadRequests.
+type RequestError struct {
+	// Request is the request without the invalid parts (eg with an empty body) so that a response can be sent, nil if
+	// no request could be made.
+	Request *http.Request
+
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return "invalid request: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error. There's deliberately no Cause method, errors.Cause stops at the RequestError.
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// as is errors.As for a target of type T. The pkg/errors wrappers this package uses don't implement Unwrap, so their
+// Cause is followed too, an error can be wrapped either way (or both).
+func as[T error](err error) (T, bool) {
+	var target T
+	for err != nil {
+		if errors.As(err, &target) {
+			return target, true
+		}
+		err = nextCause(err)
+	}
+	return target, false
+}
+
+// nextCause returns the cause of the first pkg/errors wrapper in err's Unwrap chain, nil if there isn't one.
+func nextCause(err error) error {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if c, ok := err.(interface{ Cause() error }); ok {
+			return c.Cause()
+		}
+	}
+	return nil
+}
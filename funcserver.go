@@ -2,11 +2,87 @@ package funcserver
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 )
 
+// Handler is the typed form of RequestHandler, it receives an incoming event of type Req and returns a response of
+// type Resp. Both are (un)marshalled as json, so Req & Resp are usually structs with json tags.
+type Handler[Req, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+// Invoke unmarshals payload into a Req, calls h with it and marshals the response. It implements the
+// lambdaruntime.Handler (and aws-lambda-go lambda.Handler) interface.
+func (h Handler[Req, Resp]) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var req Req
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, &EventError{Err: err}
+	}
+	resp, err := h(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
 // RequestHandler is the interface that receives an incoming request and returns a struct that can be serialised as json.
-type RequestHandler func(context.Context, map[string]interface{}) (resp interface{}, err error)
+// It's the untyped form of Handler, kept for compatibility, see Untyped.
+type RequestHandler = Handler[map[string]interface{}, interface{}]
+
+// Untyped converts a typed Handler into a RequestHandler. This is slow, the event is marshalled back into json to be
+// unmarshalled into a Req, use the Handler directly where possible.
+func Untyped[Req, Resp any](h Handler[Req, Resp]) RequestHandler {
+	return func(ctx context.Context, r map[string]interface{}) (interface{}, error) {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		var req Req
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, &EventError{Err: err}
+		}
+
+		resp, err := h(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// StreamingHandler is the typed form of StreamingRequestHandler, it receives an incoming event of type Req and streams
+// the response to w.
+type StreamingHandler[Req any] func(ctx context.Context, req Req, w io.Writer) error
+
+// InvokeStream unmarshals payload into a Req and calls h with it. It implements the lambdaruntime.StreamingHandler
+// interface.
+func (h StreamingHandler[Req]) InvokeStream(ctx context.Context, payload []byte, w io.Writer) error {
+	var req Req
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return &EventError{Err: err}
+	}
+	return h(ctx, req, w)
+}
+
+// StreamingRequestHandler is the interface that receives an incoming request and streams the response to w as it's
+// generated instead of returning it. It's the untyped form of StreamingHandler, kept for compatibility, see
+// UntypedStreaming.
+type StreamingRequestHandler = StreamingHandler[map[string]interface{}]
+
+// UntypedStreaming converts a typed StreamingHandler into a StreamingRequestHandler, see Untyped.
+func UntypedStreaming[Req any](h StreamingHandler[Req]) StreamingRequestHandler {
+	return func(ctx context.Context, r map[string]interface{}, w io.Writer) error {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		var req Req
+		if err := json.Unmarshal(data, &req); err != nil {
+			return &EventError{Err: err}
+		}
+		return h(ctx, req, w)
+	}
+}
 
 // RequestConverter is the interface to convert to an incoming request to a stdlib *http.Request.
 type RequestConverter interface {
@@ -14,4 +90,14 @@ type RequestConverter interface {
 }
 
 // ContextKey is type used to avoid context name clashes.
+//
+// Deprecated: values are stored under private keys, use the FromContext functions, eg InvocationFromContext.
 type ContextKey string
+
+// contextKey is the type of the private context keys.
+type contextKey int
+
+const (
+	errorHandlerContextKey contextKey = iota
+	invocationContextKey
+)
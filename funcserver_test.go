@@ -0,0 +1,109 @@
+package funcserver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testEvent struct {
+	Path string `json:"path"`
+}
+
+func (e testEvent) AsHTTPRequest(ctx context.Context) (*http.Request, error) {
+	return &http.Request{URL: &url.URL{Path: e.Path}}, nil
+}
+
+type testResponse struct {
+	Body string `json:"body"`
+}
+
+var testHandler = Handler[testEvent, testResponse](func(ctx context.Context, e testEvent) (testResponse, error) {
+	if e.Path == "/error" {
+		return testResponse{}, errors.New("handler failed")
+	}
+	return testResponse{Body: "path " + e.Path}, nil
+})
+
+func TestHandler(t *testing.T) {
+	t.Run("Invoke", func(t *testing.T) {
+		data, err := testHandler.Invoke(context.Background(), []byte(`{"path":"/a"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `{"body":"path /a"}` {
+			t.Errorf(`Invoke() = %s, want: %s`, data, `{"body":"path /a"}`)
+		}
+	})
+
+	t.Run("Invoke error", func(t *testing.T) {
+		if _, err := testHandler.Invoke(context.Background(), []byte(`{"path":"/error"}`)); err == nil {
+			t.Error("expected error, got nil")
+		}
+		if _, err := testHandler.Invoke(context.Background(), []byte(`not json`)); err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("Untyped", func(t *testing.T) {
+		h := Untyped(testHandler)
+
+		resp, err := h(context.Background(), map[string]interface{}{"path": "/b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.(testResponse).Body != "path /b" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.(testResponse).Body, "path /b")
+		}
+
+		resp, err = h(context.Background(), map[string]interface{}{"path": "/error"})
+		if err == nil || resp != nil {
+			t.Errorf(`h() = %v, %v, want: nil, error`, resp, err)
+		}
+	})
+
+	t.Run("InvokeStream", func(t *testing.T) {
+		h := StreamingHandler[testEvent](func(ctx context.Context, e testEvent, w io.Writer) error {
+			_, err := io.WriteString(w, e.Path)
+			return err
+		})
+
+		buf := new(bytes.Buffer)
+		if err := h.InvokeStream(context.Background(), []byte(`{"path":"/s"}`), buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "/s" {
+			t.Errorf(`body = %q, want: %q`, buf.String(), "/s")
+		}
+
+		err := h.InvokeStream(context.Background(), []byte(`not json`), buf)
+		if _, ok := err.(*EventError); !ok {
+			t.Errorf(`InvokeStream() = %v, want: *EventError`, err)
+		}
+	})
+
+	t.Run("UntypedStreaming", func(t *testing.T) {
+		h := UntypedStreaming(StreamingHandler[testEvent](func(ctx context.Context, e testEvent, w io.Writer) error {
+			_, err := io.WriteString(w, e.Path)
+			return err
+		}))
+
+		buf := new(bytes.Buffer)
+		if err := h(context.Background(), map[string]interface{}{"path": "/c"}, buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "/c" {
+			t.Errorf(`streamed = %q, want: %q`, buf.String(), "/c")
+		}
+
+		err := h(context.Background(), map[string]interface{}{"path": 1}, buf)
+		if _, ok := err.(*EventError); !ok {
+			t.Errorf(`h() = %v, want: *EventError`, err)
+		}
+	})
+}
@@ -1,7 +1,8 @@
 module github.com/j0hnsmith/funcserver
 
+go 1.21
+
 require (
-	github.com/aws/aws-lambda-go v1.8.1
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/mux v1.6.2
 	github.com/pkg/errors v0.8.1
@@ -0,0 +1,107 @@
+/*
+Package httpapilambda provides a conversion wrapper so that a http.Handler can be used in an AWS lambda function that
+is invoked with the v2.0 payload format, this is used by API Gateway HTTP APIs and lambda function URLs.
+
+The incoming json payload is turned into a http.Request, your http.Handler is called with it and an appropriate
+http.ResponseWriter, then the response is returned in the v2.0 response format. Cookies are sent and received via the
+dedicated cookies fields of the payloads, handlers can use the usual Cookie/Set-Cookie headers.
+
+Here's some background info
+https://docs.aws.amazon.com/apigateway/latest/developerguide/http-api-develop-integrations-lambda.html
+https://docs.aws.amazon.com/lambda/latest/dg/urls-invocation.html.
+
+Paths:
+
+For a HTTP API stage other than $default, rawPath starts with /{stage}, set Options.StripStage to remove it. Set
+Options.BasePath to strip the base path of a custom domain API mapping.
+
+Caveats:
+
+- request & response payloads are limited to 6mb (function URLs) or 10mb (HTTP APIs)
+
+- no streaming requests, request is received in full before the lambda is invoked
+
+- responses are buffered, handler must return before response is sent. Function URLs configured with the
+RESPONSE_STREAM invoke mode can stream responses instead, see WrapHTTPHandlerStreaming
+
+Example usage:
+
+	package main
+
+	import (
+		"net/http"
+
+		"github.com/gorilla/mux"
+		"github.com/j0hnsmith/funcserver/httpapilambda"
+		"github.com/j0hnsmith/funcserver/lambdaruntime"
+	)
+
+	func main() {
+		router := mux.NewRouter()
+		router.HandleFunc("/", func(resp http.ResponseWriter, req *http.Request) { resp.Write([]byte("<h1>Home</h1>")) })
+
+		// wrap handler to automatically convert requests/responses
+		lambdaruntime.Start(httpapilambda.WrapHTTPHandler(router, httpapilambda.Options{}))
+	}
+*/
+package httpapilambda
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Options holds the options for converting requests & responses.
+type Options struct {
+	funcserver.Options
+
+	// BasePath is the base path of a custom domain name API mapping (eg "/v1"), it is stripped from the start of the
+	// request path before the handler is called.
+	BasePath string
+
+	// StripStage removes a leading /{stage} segment from the request path.
+	StripStage bool
+
+	// ContentTypes decides which response bodies are binary & so base64 encoded.
+	ContentTypes funcserver.ContentClassifier
+}
+
+// WrapHTTPHandler is wrapper around a http.Handler to convert requests & responses for use in a AWS Lambda function
+// invoked with the v2.0 payload format, ie via an API Gateway HTTP API or a lambda function URL. It's the untyped form
+// of TypedHandler.
+func WrapHTTPHandler(h http.Handler, opts Options) funcserver.RequestHandler {
+	return funcserver.Untyped(TypedHandler(h, opts))
+}
+
+// TypedHandler is the same as WrapHTTPHandler but the handler receives a Request and returns a Response. It
+// implements the lambdaruntime.Handler interface, the payload is decoded straight into a Request.
+func TypedHandler(h http.Handler, opts Options) funcserver.Handler[Request, Response] {
+	return funcserver.WrapWithOptions[Request, Response](NewAdapter(opts), h, opts.Options)
+}
+
+// Adapter converts events to requests and responses to events, it implements funcserver.Adapter.
+type Adapter struct {
+	opts Options
+}
+
+// NewAdapter returns an Adapter that converts requests according to opts.
+func NewAdapter(opts Options) Adapter {
+	return Adapter{opts: opts}
+}
+
+// DecodeRequest converts httpr to a *http.Request, stripping the path according to the options.
+func (a Adapter) DecodeRequest(ctx context.Context, httpr Request) (*http.Request, error) {
+	req, err := httpr.AsHTTPRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Path, req.URL.RawPath = a.opts.stripPath(req.URL.Path, req.URL.RawPath, httpr.RequestContext.Stage)
+	return req, nil
+}
+
+// EncodeResponse converts a recorded response to a Response.
+func (a Adapter) EncodeResponse(req *http.Request, res funcserver.RecordedResponse) (Response, error) {
+	return encodeResponse(res, a.opts), nil
+}
@@ -0,0 +1,194 @@
+package httpapilambda
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Request represents an http request in the v2.0 payload format, as sent by API Gateway HTTP APIs and lambda function
+// URLs. It's container to marshal json into that can be converted to a *http.Request.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/http-api-develop-integrations-lambda.html#http-api-develop-integrations-lambda.proxy-format
+type Request struct {
+	Version               string            `json:"version"`
+	RouteKey              string            `json:"routeKey"`
+	RawPath               string            `json:"rawPath"`
+	RawQueryString        string            `json:"rawQueryString"`
+	Cookies               []string          `json:"cookies,omitempty"`
+	Headers               map[string]string `json:"headers,omitempty"`
+	QueryStringParameters map[string]string `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string `json:"pathParameters,omitempty"`
+	StageVariables        map[string]string `json:"stageVariables,omitempty"`
+	RequestContext        RequestContext    `json:"requestContext"`
+	IsBase64Encoded       bool              `json:"isBase64Encoded"`
+	Body                  string            `json:"body,omitempty"`
+}
+
+var _ funcserver.RequestConverter = Request{}
+
+// contextKey is the type of the context keys private to this package.
+type contextKey int
+
+const (
+	requestContextKey contextKey = iota
+	pathParametersContextKey
+	stageVariablesContextKey
+)
+
+// RequestContext holds information about the request. This is accessed via RequestContextFromContext.
+type RequestContext struct {
+	AccountID    string      `json:"accountId"`
+	APIID        string      `json:"apiId"`
+	Authorizer   *Authorizer `json:"authorizer,omitempty"`
+	DomainName   string      `json:"domainName"`
+	DomainPrefix string      `json:"domainPrefix"`
+	HTTP         HTTP        `json:"http"`
+	RequestID    string      `json:"requestId"`
+	RouteKey     string      `json:"routeKey"`
+	Stage        string      `json:"stage"`
+	Time         string      `json:"time"`
+	TimeEpoch    int64       `json:"timeEpoch"`
+}
+
+// HTTP holds the http details of the request.
+type HTTP struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// Authorizer holds the output of the authorizer that authorized the request, only one of the fields is set.
+type Authorizer struct {
+	JWT    *JWTAuthorizer         `json:"jwt,omitempty"`
+	Lambda map[string]interface{} `json:"lambda,omitempty"`
+	IAM    *IAMAuthorizer         `json:"iam,omitempty"`
+}
+
+// JWTAuthorizer holds the claims and scopes of a verified JWT.
+type JWTAuthorizer struct {
+	Claims map[string]string `json:"claims"`
+	Scopes []string          `json:"scopes"`
+}
+
+// IAMAuthorizer holds the IAM identity of the caller, used by function URLs with AWS_IAM auth and HTTP APIs with IAM
+// authorization.
+type IAMAuthorizer struct {
+	AccessKey      string `json:"accessKey"`
+	AccountID      string `json:"accountId"`
+	CallerID       string `json:"callerId"`
+	PrincipalOrgID string `json:"principalOrgId"`
+	UserArn        string `json:"userArn"`
+	UserID         string `json:"userId"`
+}
+
+// AsHTTPRequest converts to the equivalent *http.Request so that the request can be processed via standard net/http
+// functionality.
+func (httpr Request) AsHTTPRequest(ctx context.Context) (*http.Request, error) {
+	u := &url.URL{RawQuery: httpr.RawQueryString}
+	funcserver.SetPath(u, httpr.RawPath)
+
+	headers := make(http.Header, len(httpr.Headers)+1)
+	for k, v := range httpr.Headers {
+		headers.Set(k, v)
+	}
+	// cookies are removed from the headers and sent separately
+	if len(httpr.Cookies) > 0 {
+		headers.Set("Cookie", strings.Join(httpr.Cookies, "; "))
+	}
+
+	bodyStr, bodyErr := funcserver.DecodeBody(httpr.Body, httpr.IsBase64Encoded)
+
+	// as with net/http.Server the Host header is removed
+	host := headers.Get("Host")
+	headers.Del("Host")
+	if host == "" {
+		host = httpr.RequestContext.DomainName
+	}
+
+	r := &http.Request{
+		Method:        httpr.RequestContext.HTTP.Method,
+		URL:           u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Host:          host,
+		ContentLength: int64(len(bodyStr)),
+		Body:          ioutil.NopCloser(strings.NewReader(bodyStr)),
+	}
+	// api gateway & function urls only accept https
+	sourceIP, _ := netip.ParseAddr(httpr.RequestContext.HTTP.SourceIP)
+	funcserver.SetServerFields(r, "https", sourceIP)
+	if major, minor, ok := http.ParseHTTPVersion(httpr.RequestContext.HTTP.Protocol); ok {
+		r.Proto, r.ProtoMajor, r.ProtoMinor = httpr.RequestContext.HTTP.Protocol, major, minor
+	}
+
+	ctx = context.WithValue(ctx, requestContextKey, httpr.RequestContext)
+	ctx = context.WithValue(ctx, pathParametersContextKey, httpr.PathParameters)
+	ctx = context.WithValue(ctx, stageVariablesContextKey, httpr.StageVariables)
+	r = r.WithContext(ctx)
+
+	if bodyErr != nil {
+		return nil, &funcserver.RequestError{Request: r, Err: bodyErr}
+	}
+	return r, nil
+}
+
+// stripPath removes the stage and/or the base path from the start of the path (and the raw path if set) according
+// to opts.
+func (opts Options) stripPath(p, rawPath, stage string) (string, string) {
+	var prefixes []string
+	if opts.StripStage && stage != "" && stage != "$default" {
+		prefixes = append(prefixes, "/"+stage)
+	}
+	if base := strings.Trim(opts.BasePath, "/"); base != "" {
+		prefixes = append(prefixes, "/"+base)
+	}
+	for _, prefix := range prefixes {
+		p = funcserver.StripPathPrefix(p, prefix)
+		if rawPath != "" {
+			rawPath = funcserver.StripPathPrefix(rawPath, prefix)
+		}
+	}
+	return p, rawPath
+}
+
+// RequestContextFromContext returns the request context of the request.
+func RequestContextFromContext(ctx context.Context) (RequestContext, bool) {
+	rc, ok := ctx.Value(requestContextKey).(RequestContext)
+	return rc, ok
+}
+
+// AuthorizerFromContext returns the authorizer output of the request, ok is false if the request wasn't authorized.
+func AuthorizerFromContext(ctx context.Context) (a Authorizer, ok bool) {
+	rc, _ := RequestContextFromContext(ctx)
+	if rc.Authorizer == nil {
+		return Authorizer{}, false
+	}
+	return *rc.Authorizer, true
+}
+
+// PathParameters returns the path parameters matched against the route, eg {"id": "123"} for a route
+// GET /products/{id}. Always nil for function URLs.
+func PathParameters(ctx context.Context) map[string]string {
+	pp, _ := ctx.Value(pathParametersContextKey).(map[string]string)
+	return pp
+}
+
+// PathParameter returns the named path parameter, "" if it doesn't exist.
+func PathParameter(ctx context.Context, name string) string {
+	return PathParameters(ctx)[name]
+}
+
+// StageVariables returns the stage variables of the stage that received the request.
+func StageVariables(ctx context.Context) map[string]string {
+	sv, _ := ctx.Value(stageVariablesContextKey).(map[string]string)
+	return sv
+}
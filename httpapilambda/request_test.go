@@ -0,0 +1,265 @@
+package httpapilambda
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRequest(t *testing.T) { // nolint: gocyclo
+	t.Run("method, path & query", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.Method != http.MethodPut {
+				t.Errorf(`req.Method = %q, want: %q`, req.Method, http.MethodPut)
+			}
+			if req.URL.Path != "/files/a/b" {
+				t.Errorf(`req.URL.Path = %q, want: %q`, req.URL.Path, "/files/a/b")
+			}
+			if req.URL.EscapedPath() != "/files/a%2Fb" {
+				t.Errorf(`req.URL.EscapedPath() = %q, want: %q`, req.URL.EscapedPath(), "/files/a%2Fb")
+			}
+			if req.URL.RawQuery != "q=x%26y&q=z" {
+				t.Errorf(`req.URL.RawQuery = %q, want: %q`, req.URL.RawQuery, "q=x%26y&q=z")
+			}
+			if !reflect.DeepEqual(req.URL.Query()["q"], []string{"x&y", "z"}) {
+				t.Errorf(`req.URL.Query()["q"] = %q, want: %q`, req.URL.Query()["q"], []string{"x&y", "z"})
+			}
+			if req.RequestURI != "/files/a%2Fb?q=x%26y&q=z" {
+				t.Errorf(`req.RequestURI = %q, want: %q`, req.RequestURI, "/files/a%2Fb?q=x%26y&q=z")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		httpr := Request{
+			RawPath:        "/files/a%2Fb",
+			RawQueryString: "q=x%26y&q=z",
+			RequestContext: RequestContext{HTTP: HTTP{Method: http.MethodPut}},
+		}
+		_, err := f(context.Background(), httprToMapStringInterface(httpr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("raw paths", func(t *testing.T) {
+		for _, tc := range []struct {
+			rawPath     string
+			wantPath    string
+			wantEscaped string
+		}{
+			{"//evil.com/x", "//evil.com/x", "//evil.com/x"},
+			{"/a%2Fb", "/a/b", "/a%2Fb"},
+			{"//a%2Fb", "//a/b", "//a%2Fb"},
+			{"/a%zzb", "/a%zzb", "/a%25zzb"},
+		} {
+			t.Run(tc.rawPath, func(t *testing.T) {
+				h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					if req.URL.Host != "example.com" {
+						t.Errorf(`req.URL.Host = %q, want: %q`, req.URL.Host, "example.com")
+					}
+					if req.URL.Path != tc.wantPath {
+						t.Errorf(`req.URL.Path = %q, want: %q`, req.URL.Path, tc.wantPath)
+					}
+					if req.URL.EscapedPath() != tc.wantEscaped {
+						t.Errorf(`req.URL.EscapedPath() = %q, want: %q`, req.URL.EscapedPath(), tc.wantEscaped)
+					}
+				})
+
+				f := WrapHTTPHandler(h, Options{})
+				httpr := Request{RawPath: tc.rawPath, RequestContext: RequestContext{DomainName: "example.com"}}
+				_, err := f(context.Background(), httprToMapStringInterface(httpr))
+				if err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	})
+
+	t.Run("path stripping", func(t *testing.T) {
+		pathTests := []struct {
+			name         string
+			rawPath      string
+			stage        string
+			opts         Options
+			expectedPath string
+		}{
+			{
+				name:         "no options",
+				rawPath:      "/prod/products",
+				stage:        "prod",
+				expectedPath: "/prod/products",
+			},
+			{
+				name:         "stage",
+				rawPath:      "/prod/products",
+				stage:        "prod",
+				opts:         Options{StripStage: true},
+				expectedPath: "/products",
+			},
+			{
+				name:         "default stage",
+				rawPath:      "/products",
+				stage:        "$default",
+				opts:         Options{StripStage: true},
+				expectedPath: "/products",
+			},
+			{
+				name:         "base path",
+				rawPath:      "/v1/products",
+				opts:         Options{BasePath: "/v1"},
+				expectedPath: "/products",
+			},
+		}
+
+		for _, tc := range pathTests {
+			t.Run(tc.name, func(t *testing.T) {
+				h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					if req.URL.Path != tc.expectedPath {
+						t.Errorf(`req.URL.Path = %q, want: %q`, req.URL.Path, tc.expectedPath)
+					}
+				})
+
+				f := WrapHTTPHandler(h, tc.opts)
+				httpr := Request{RawPath: tc.rawPath, RequestContext: RequestContext{Stage: tc.stage}}
+				_, err := f(context.Background(), httprToMapStringInterface(httpr))
+				if err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	})
+
+	t.Run("headers, cookies & request details", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Accept") != "text/html" {
+				t.Errorf(`req.Header.Get("Accept") = %q, want: %q`, req.Header.Get("Accept"), "text/html")
+			}
+			c, err := req.Cookie("b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Value != "2" {
+				t.Errorf(`c.Value = %q, want: %q`, c.Value, "2")
+			}
+			if len(req.Cookies()) != 2 {
+				t.Errorf(`len(req.Cookies()) = %d, want: %d`, len(req.Cookies()), 2)
+			}
+			if req.Host != "abc.lambda-url.eu-west-2.on.aws" {
+				t.Errorf(`req.Host = %q, want: %q`, req.Host, "abc.lambda-url.eu-west-2.on.aws")
+			}
+			if req.RemoteAddr != "192.0.2.1:0" {
+				t.Errorf(`req.RemoteAddr = %q, want: %q`, req.RemoteAddr, "192.0.2.1:0")
+			}
+			if req.URL.Scheme != "https" || req.URL.Host != "abc.lambda-url.eu-west-2.on.aws" {
+				t.Errorf(`req.URL = %q, want: %q`, req.URL.String(), "https://abc.lambda-url.eu-west-2.on.aws/")
+			}
+			if req.TLS == nil || req.TLS.ServerName != "abc.lambda-url.eu-west-2.on.aws" {
+				t.Errorf(`req.TLS = %v, want: ServerName %q`, req.TLS, "abc.lambda-url.eu-west-2.on.aws")
+			}
+			if req.Proto != "HTTP/1.1" {
+				t.Errorf(`req.Proto = %q, want: %q`, req.Proto, "HTTP/1.1")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		httpr := Request{
+			RawPath: "/",
+			Headers: map[string]string{"accept": "text/html"},
+			Cookies: []string{"a=1", "b=2"},
+			RequestContext: RequestContext{
+				DomainName: "abc.lambda-url.eu-west-2.on.aws",
+				HTTP:       HTTP{Method: http.MethodGet, Protocol: "HTTP/1.1", SourceIP: "192.0.2.1"},
+			},
+		}
+		_, err := f(context.Background(), httprToMapStringInterface(httpr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("body", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(body) != "request body" {
+				t.Errorf(`body = %q, want: %q`, body, "request body")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		httpr := Request{RawPath: "/", Body: "cmVxdWVzdCBib2R5", IsBase64Encoded: true}
+		_, err := f(context.Background(), httprToMapStringInterface(httpr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("context accessors", func(t *testing.T) {
+		httpr := Request{
+			RawPath:        "/products/123",
+			PathParameters: map[string]string{"id": "123"},
+			RequestContext: RequestContext{
+				RequestID: "JKJaXmPLvHcESHA=",
+				Authorizer: &Authorizer{
+					JWT: &JWTAuthorizer{Claims: map[string]string{"sub": "user"}, Scopes: []string{"read"}},
+				},
+			},
+		}
+
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			if id := PathParameter(ctx, "id"); id != "123" {
+				t.Errorf(`PathParameter(ctx, "id") = %q, want: %q`, id, "123")
+			}
+			rc, _ := RequestContextFromContext(ctx)
+			if rc.RequestID != httpr.RequestContext.RequestID {
+				t.Errorf(`rc.RequestID = %q, want: %q`, rc.RequestID, httpr.RequestContext.RequestID)
+			}
+			a, ok := AuthorizerFromContext(ctx)
+			if !ok || a.JWT == nil {
+				t.Fatal("expected jwt authorizer")
+			}
+			if a.JWT.Claims["sub"] != "user" {
+				t.Errorf(`a.JWT.Claims["sub"] = %q, want: %q`, a.JWT.Claims["sub"], "user")
+			}
+		})
+
+		f := WrapHTTPHandler(h, Options{})
+		_, err := f(context.Background(), httprToMapStringInterface(httpr))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("req body encoding error", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+
+		f := WrapHTTPHandler(h, Options{})
+		httpr := Request{RawPath: "/", Body: "not base64", IsBase64Encoded: true}
+		_, err := f(context.Background(), httprToMapStringInterface(httpr))
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
+
+func httprToMapStringInterface(httpr Request) map[string]interface{} {
+	data, err := json.Marshal(httpr)
+	if err != nil {
+		panic("unable to marshal Request")
+	}
+
+	m := make(map[string]interface{})
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		panic("unable to unmarshal into map[string]interface{}")
+	}
+
+	return m
+}
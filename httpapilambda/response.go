@@ -0,0 +1,41 @@
+package httpapilambda
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Response represents a response in the v2.0 format. Set-Cookie headers are sent via Cookies, all other repeated
+// headers are combined into a single comma separated value.
+// https://docs.aws.amazon.com/apigateway/latest/developerguide/http-api-develop-integrations-lambda.html#http-api-develop-integrations-lambda.response
+type Response struct {
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Cookies         []string          `json:"cookies,omitempty"`
+	Body            string            `json:"body"`
+}
+
+// encodeResponse converts a recorded response to a Response.
+func encodeResponse(res funcserver.RecordedResponse, opts Options) Response {
+	resp := Response{StatusCode: res.StatusCode}
+	resp.Headers, resp.Cookies = flattenHeader(res.Header)
+	resp.Body, resp.IsBase64Encoded = opts.ContentTypes.EncodeBody(res.Header, res.Body)
+
+	return resp
+}
+
+// flattenHeader converts h to the single value headers & cookies of the v2.0 format.
+func flattenHeader(h http.Header) (headers map[string]string, cookies []string) {
+	headers = make(map[string]string, len(h))
+	for k, vv := range h {
+		if http.CanonicalHeaderKey(k) == "Set-Cookie" {
+			cookies = append(cookies, vv...)
+			continue
+		}
+		headers[http.CanonicalHeaderKey(k)] = strings.Join(vv, ", ")
+	}
+	return headers, cookies
+}
@@ -0,0 +1,81 @@
+package httpapilambda
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestResponse(t *testing.T) {
+	t.Run("body & default status", func(t *testing.T) {
+		expectedBody := `{"hello":"world"}`
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "application/json")
+			_, _ = res.Write([]byte(expectedBody))
+		})
+
+		resp := callHandlerReturnResp(t, h)
+
+		if resp.Body != expectedBody {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, expectedBody)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusOK)
+		}
+		if resp.IsBase64Encoded {
+			t.Error("resp.IsBase64Encoded = true, want: false")
+		}
+	})
+
+	t.Run("cookies & repeated headers", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			http.SetCookie(res, &http.Cookie{Name: "a", Value: "1", Path: "/"})
+			http.SetCookie(res, &http.Cookie{Name: "b", Value: "2"})
+			res.Header().Add("Vary", "Accept")
+			res.Header().Add("Vary", "Accept-Encoding")
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		resp := callHandlerReturnResp(t, h)
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf(`resp.StatusCode = %d, want: %d`, resp.StatusCode, http.StatusNoContent)
+		}
+		if !reflect.DeepEqual(resp.Cookies, []string{"a=1; Path=/", "b=2"}) {
+			t.Errorf(`resp.Cookies = %q, want: %q`, resp.Cookies, []string{"a=1; Path=/", "b=2"})
+		}
+		if _, ok := resp.Headers["Set-Cookie"]; ok {
+			t.Error(`resp.Headers["Set-Cookie"] exists, want: moved to resp.Cookies`)
+		}
+		if resp.Headers["Vary"] != "Accept, Accept-Encoding" {
+			t.Errorf(`resp.Headers["Vary"] = %q, want: %q`, resp.Headers["Vary"], "Accept, Accept-Encoding")
+		}
+	})
+
+	t.Run("binary body b64 encoded", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = res.Write([]byte{0, 1, 2})
+		})
+
+		resp := callHandlerReturnResp(t, h)
+
+		if !resp.IsBase64Encoded {
+			t.Error("resp.IsBase64Encoded = false, want: true")
+		}
+		if resp.Body != "AAEC" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "AAEC")
+		}
+	})
+}
+
+func callHandlerReturnResp(t *testing.T, h http.Handler) Response {
+	f := WrapHTTPHandler(h, Options{})
+
+	r, err := f(context.Background(), httprToMapStringInterface(Request{RawPath: "/"}))
+	if err != nil {
+		t.Error(err)
+	}
+	return r.(Response)
+}
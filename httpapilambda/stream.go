@@ -0,0 +1,58 @@
+package httpapilambda
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/j0hnsmith/funcserver"
+	"github.com/pkg/errors"
+)
+
+// StreamingContentType is the content type of a streamed function URL response, the runtime API must be sent it
+// along with the response stream.
+const StreamingContentType = "application/vnd.awslambda.http-integration-response"
+
+// preludeDelimiter separates the json prelude (status code, headers & cookies) from the body.
+var preludeDelimiter = make([]byte, 8)
+
+// WrapHTTPHandlerStreaming is wrapper around a http.Handler for use in a AWS Lambda function URL with the
+// RESPONSE_STREAM invoke mode. Instead of buffering the response, the status code & headers are written to w
+// followed by the body as the handler writes (and flushes) it, this allows for Server-Sent Events and responses larger
+// than the 6mb buffered response limit.
+//
+// The buffering of body writes & the funcserver.Options that apply are described by funcserver.WrapStreaming, a panic
+// after the response was committed is sent in the stream's trailers.
+//
+// w is usually the writer provided by lambdaruntime.Client.StreamResponse, with StreamingContentType as the
+// content type.
+// https://docs.aws.amazon.com/lambda/latest/dg/configuration-response-streaming.html
+//
+// It's the untyped form of TypedStreamingHandler, lambdaruntime.StartStreaming decodes the payload straight into a
+// Request for a TypedStreamingHandler, which avoids the map -> json -> Request round trip.
+func WrapHTTPHandlerStreaming(h http.Handler, opts Options) funcserver.StreamingRequestHandler {
+	return funcserver.UntypedStreaming(TypedStreamingHandler(h, opts))
+}
+
+// TypedStreamingHandler is the same as WrapHTTPHandlerStreaming but the handler receives a Request.
+func TypedStreamingHandler(h http.Handler, opts Options) funcserver.StreamingHandler[Request] {
+	return funcserver.WrapStreaming[Request](NewAdapter(opts), h, opts.Options)
+}
+
+// streamingPrelude is the first part of a streamed response.
+type streamingPrelude struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Cookies    []string          `json:"cookies,omitempty"`
+}
+
+// EncodePrelude returns the prelude of a streamed response followed by the delimiter, it implements
+// funcserver.StreamingAdapter.
+func (a Adapter) EncodePrelude(req *http.Request, statusCode int, header http.Header) ([]byte, error) {
+	p := streamingPrelude{StatusCode: statusCode}
+	p.Headers, p.Cookies = flattenHeader(header)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal streaming prelude")
+	}
+	return append(data, preludeDelimiter...), nil
+}
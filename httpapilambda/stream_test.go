@@ -0,0 +1,237 @@
+package httpapilambda
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/j0hnsmith/funcserver"
+	"github.com/j0hnsmith/funcserver/lambdaruntime"
+)
+
+// splitStream splits a streamed response into its prelude & body.
+func splitStream(t *testing.T, data []byte) (streamingPrelude, string) {
+	i := bytes.Index(data, preludeDelimiter)
+	if i < 0 {
+		t.Fatalf("no prelude delimiter in %q", data)
+	}
+	var p streamingPrelude
+	if err := json.Unmarshal(data[:i], &p); err != nil {
+		t.Fatal(err)
+	}
+	return p, string(data[i+len(preludeDelimiter):])
+}
+
+func TestStreamingResponse(t *testing.T) {
+	t.Run("prelude & body", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			http.SetCookie(res, &http.Cookie{Name: "a", Value: "1"})
+			res.Header().Set("X-Some-Header", "some value")
+			res.WriteHeader(http.StatusAccepted)
+			_, _ = res.Write([]byte("<h1>Hello</h1>"))
+		})
+
+		buf := new(bytes.Buffer)
+		f := WrapHTTPHandlerStreaming(h, Options{})
+		err := f(context.Background(), httprToMapStringInterface(Request{RawPath: "/"}), buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, body := splitStream(t, buf.Bytes())
+		if p.StatusCode != http.StatusAccepted {
+			t.Errorf(`p.StatusCode = %d, want: %d`, p.StatusCode, http.StatusAccepted)
+		}
+		if p.Headers["X-Some-Header"] != "some value" {
+			t.Errorf(`p.Headers["X-Some-Header"] = %q, want: %q`, p.Headers["X-Some-Header"], "some value")
+		}
+		if p.Headers["Content-Type"] != "text/html; charset=utf-8" {
+			t.Errorf(`p.Headers["Content-Type"] = %q, want: %q`, p.Headers["Content-Type"], "text/html; charset=utf-8")
+		}
+		if !reflect.DeepEqual(p.Cookies, []string{"a=1"}) {
+			t.Errorf(`p.Cookies = %q, want: %q`, p.Cookies, []string{"a=1"})
+		}
+		if body != "<h1>Hello</h1>" {
+			t.Errorf(`body = %q, want: %q`, body, "<h1>Hello</h1>")
+		}
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(http.StatusNoContent)
+		})
+
+		buf := new(bytes.Buffer)
+		f := WrapHTTPHandlerStreaming(h, Options{})
+		err := f(context.Background(), httprToMapStringInterface(Request{RawPath: "/"}), buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, body := splitStream(t, buf.Bytes())
+		if p.StatusCode != http.StatusNoContent {
+			t.Errorf(`p.StatusCode = %d, want: %d`, p.StatusCode, http.StatusNoContent)
+		}
+		if body != "" {
+			t.Errorf(`body = %q, want: ""`, body)
+		}
+	})
+
+	t.Run("switching protocols ignored", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(http.StatusSwitchingProtocols)
+			_, _ = res.Write([]byte("body"))
+		})
+
+		buf := new(bytes.Buffer)
+		f := WrapHTTPHandlerStreaming(h, Options{})
+		err := f(context.Background(), httprToMapStringInterface(Request{RawPath: "/"}), buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, _ := splitStream(t, buf.Bytes())
+		if p.StatusCode != http.StatusOK {
+			t.Errorf(`p.StatusCode = %d, want: %d`, p.StatusCode, http.StatusOK)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			panic("boom")
+		})
+
+		f := WrapHTTPHandlerStreaming(h, Options{})
+		err := f(context.Background(), httprToMapStringInterface(Request{RawPath: "/"}), new(bytes.Buffer))
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+
+	t.Run("panic options", func(t *testing.T) {
+		for _, tc := range []struct {
+			name       string
+			flush      bool
+			wantErr    bool
+			wantStatus int
+		}{
+			{"recovered", false, false, http.StatusInternalServerError},
+			{"committed", true, true, http.StatusOK},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					_, _ = res.Write([]byte("partial"))
+					if tc.flush {
+						res.(http.Flusher).Flush()
+					}
+					panic("boom")
+				})
+
+				var reported []byte
+				opts := Options{}
+				opts.RecoverPanics = true
+				opts.PanicReporter = func(req *http.Request, err error, stack []byte) {
+					reported = stack
+				}
+
+				buf := new(bytes.Buffer)
+				f := WrapHTTPHandlerStreaming(h, opts)
+				err := f(context.Background(), httprToMapStringInterface(Request{RawPath: "/"}), buf)
+				if (err != nil) != tc.wantErr {
+					t.Errorf(`err = %v, want error: %t`, err, tc.wantErr)
+				}
+				if !bytes.Contains(reported, []byte("stream_test.go")) {
+					t.Errorf("stack = %s, want the handler's frame", reported)
+				}
+
+				p, body := splitStream(t, buf.Bytes())
+				if p.StatusCode != tc.wantStatus {
+					t.Errorf(`p.StatusCode = %d, want: %d`, p.StatusCode, tc.wantStatus)
+				}
+				if tc.flush != (body == "partial") {
+					t.Errorf(`body = %q`, body)
+				}
+			})
+		}
+	})
+
+	t.Run("bad request & cold start", func(t *testing.T) {
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+
+		var hooks int
+		opts := Options{}
+		opts.RespondToBadRequests = true
+		opts.OnColdStart = []func(ctx context.Context){func(ctx context.Context) {
+			hooks++
+			if _, ok := funcserver.InvocationFromContext(ctx); !ok {
+				t.Error("no invocation in the context")
+			}
+		}}
+		f := WrapHTTPHandlerStreaming(h, opts)
+
+		for i := 0; i < 2; i++ {
+			buf := new(bytes.Buffer)
+			err := f(context.Background(), httprToMapStringInterface(Request{RawPath: "/", Body: "not base64", IsBase64Encoded: true}), buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, _ := splitStream(t, buf.Bytes())
+			if p.StatusCode != http.StatusBadRequest {
+				t.Errorf(`p.StatusCode = %d, want: %d`, p.StatusCode, http.StatusBadRequest)
+			}
+		}
+		if hooks != 1 {
+			t.Errorf(`hooks = %d, want: %d`, hooks, 1)
+		}
+	})
+
+	t.Run("server-sent events via runtime api", func(t *testing.T) {
+		events := make(chan string)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Type") != StreamingContentType {
+				t.Errorf(`Content-Type = %q, want: %q`, r.Header.Get("Content-Type"), StreamingContentType)
+			}
+			s := bufio.NewScanner(r.Body)
+			for s.Scan() {
+				// the first event shares a line with the prelude
+				if l := s.Text(); strings.Contains(l, "data: ") {
+					events <- l[strings.Index(l, "data: "):]
+				}
+			}
+			close(events)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer srv.Close()
+
+		h := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "text/event-stream")
+			for _, e := range []string{"data: 1", "data: 2"} {
+				_, _ = io.WriteString(res, e+"\n\n")
+				res.(http.Flusher).Flush()
+				// the event must be received by the runtime api before the handler sends the next one
+				if got := <-events; got != e {
+					t.Errorf(`event = %q, want: %q`, got, e)
+				}
+			}
+		})
+
+		f := WrapHTTPHandlerStreaming(h, Options{})
+		c := lambdaruntime.NewClient(strings.TrimPrefix(srv.URL, "http://"))
+		err := c.StreamResponse(context.Background(), "req-1", StreamingContentType, func(w io.Writer) error {
+			return f(context.Background(), httprToMapStringInterface(Request{RawPath: "/events"}), w)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := <-events; ok {
+			t.Error("unexpected extra event")
+		}
+	})
+}
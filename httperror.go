@@ -0,0 +1,155 @@
+package funcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTPError is an error with the status code & message to send to the client. The cause, Err, is only for logging,
+// it's never sent to the client.
+type HTTPError struct {
+	// Status is the http status code of the response.
+	Status int
+
+	// Message is the public message, the status text is used if it's empty.
+	Message string
+
+	// Err is the underlying error, it may be nil.
+	Err error
+}
+
+// NewHTTPError returns an HTTPError with the status code, public message & underlying error.
+func NewHTTPError(status int, message string, err error) *HTTPError {
+	return &HTTPError{Status: status, Message: message, Err: err}
+}
+
+func (e *HTTPError) Error() string {
+	msg := strconv.Itoa(e.Status) + " " + e.message()
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error. There's deliberately no Cause method, errors.Cause stops at the HTTPError.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HTTPError) message() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return http.StatusText(e.Status)
+}
+
+// HTTPHandlerFunc is an http.HandlerFunc that can return an error. A returned error is written with the
+// Options.ErrorHandler of the adapter serving the request, or WriteError if there is none.
+type HTTPHandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP calls f(w, r) and writes the error it returns, if any.
+func (f HTTPHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f(w, r); err != nil {
+		errorHandlerFromContext(r.Context())(w, r, err)
+	}
+}
+
+func withErrorHandler(ctx context.Context, eh func(w http.ResponseWriter, r *http.Request, err error)) context.Context {
+	return context.WithValue(ctx, errorHandlerContextKey, eh)
+}
+
+func errorHandlerFromContext(ctx context.Context) func(w http.ResponseWriter, r *http.Request, err error) {
+	if eh, ok := ctx.Value(errorHandlerContextKey).(func(w http.ResponseWriter, r *http.Request, err error)); ok && eh != nil {
+		return eh
+	}
+	return WriteError
+}
+
+// WriteError is the default Options.ErrorHandler, it writes err as the response to r. The status code & message are
+// taken from an *HTTPError, a *RequestError is a 400 Bad Request and any other error a 500 Internal Server Error
+// without details. The response is json problem details (RFC 9457) or html if r's Accept header prefers them, plain
+// text otherwise.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status, msg := http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+	if e, ok := as[*HTTPError](err); ok {
+		status, msg = e.Status, e.message()
+	} else if _, ok := as[*RequestError](err); ok {
+		status, msg = http.StatusBadRequest, http.StatusText(http.StatusBadRequest)
+	}
+
+	h := w.Header()
+	// headers set for the successful response don't apply to the error
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Del("Etag")
+	h.Del("Last-Modified")
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	switch negotiateError(r.Header.Get("Accept")) {
+	case "json":
+		h.Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(problemDetails{
+			Type:   "about:blank",
+			Title:  http.StatusText(status),
+			Status: status,
+			Detail: msg,
+		})
+	case "html":
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%d %s</title></head><body><h1>%s</h1><p>%s</p></body></html>\n",
+			status, html.EscapeString(http.StatusText(status)), html.EscapeString(http.StatusText(status)), html.EscapeString(msg))
+	default:
+		http.Error(w, msg, status)
+	}
+}
+
+// problemDetails is the json problem details object, see RFC 9457.
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// errorMediaTypes are the media types an error can be written as, wildcards aren't matched so that clients that
+// accept anything get plain text.
+var errorMediaTypes = map[string]string{
+	"application/problem+json": "json",
+	"application/json":         "json",
+	"text/html":                "html",
+}
+
+// negotiateError returns the errorMediaTypes format with the highest q value in the accept header, "" if there's
+// none. Ties go to the first listed.
+func negotiateError(accept string) string {
+	var format string
+	var best float64
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		f, ok := errorMediaTypes[mt]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if q > best {
+			format, best = f, q
+		}
+	}
+	return format
+}
@@ -0,0 +1,120 @@
+package funcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWriteError(t *testing.T) {
+	notFound := errors.Wrap(NewHTTPError(http.StatusNotFound, "no such widget", errors.New("sql: no rows")), "loading widget")
+
+	t.Run("plain text", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		WriteError(w, httptest.NewRequest("GET", "/", nil), notFound)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf(`w.Code = %d, want: %d`, w.Code, http.StatusNotFound)
+		}
+		if w.Body.String() != "no such widget\n" {
+			t.Errorf(`w.Body = %q, want: %q`, w.Body.String(), "no such widget\n")
+		}
+	})
+
+	t.Run("problem details", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "text/html;q=0.5, application/json")
+		w := httptest.NewRecorder()
+		WriteError(w, r, notFound)
+
+		if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf(`Content-Type = %q, want: %q`, ct, "application/problem+json")
+		}
+		var p problemDetails
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		want := problemDetails{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "no such widget"}
+		if p != want {
+			t.Errorf(`problem = %+v, want: %+v`, p, want)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		w := httptest.NewRecorder()
+		WriteError(w, r, NewHTTPError(http.StatusForbidden, "<nope>", nil))
+
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf(`Content-Type = %q, want: %q`, ct, "text/html; charset=utf-8")
+		}
+		if !strings.Contains(w.Body.String(), "<p>&lt;nope&gt;</p>") {
+			t.Errorf(`w.Body = %q, want escaped message`, w.Body.String())
+		}
+	})
+
+	t.Run("other errors hidden", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		WriteError(w, httptest.NewRequest("GET", "/", nil), errors.New("secret"))
+
+		if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") {
+			t.Errorf(`response = %d %q, want: %d without the error`, w.Code, w.Body.String(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestHTTPHandlerFunc(t *testing.T) {
+	h := HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return NewHTTPError(http.StatusConflict, "", nil)
+	})
+
+	resp, err := Wrap[testEvent, testResponse](testAdapter{}, h)(context.Background(), testEvent{Path: "/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "text/plain; charset=utf-8 Conflict\n" {
+		t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 Conflict\n")
+	}
+
+	opts := Options{ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(err.(*HTTPError).Status)
+		_, _ = w.Write([]byte(`{"error":"custom"}`))
+	}}
+	resp, err = WrapWithOptions[testEvent, testResponse](testAdapter{}, h, opts)(context.Background(), testEvent{Path: "/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != `application/json {"error":"custom"}` {
+		t.Errorf(`resp.Body = %q, want: %q`, resp.Body, `application/json {"error":"custom"}`)
+	}
+}
+
+func TestHTTPHandlerFuncWrappedError(t *testing.T) {
+	for name, err := range map[string]error{
+		"fmt":        fmt.Errorf("load user: %w", NewHTTPError(http.StatusNotFound, "nope", nil)),
+		"pkg/errors": errors.Wrap(NewHTTPError(http.StatusNotFound, "nope", nil), "load user"),
+		"both":       fmt.Errorf("handler: %w", errors.Wrap(NewHTTPError(http.StatusNotFound, "nope", nil), "load user")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				return err
+			})
+
+			resp, err := Wrap[testEvent, testResponse](testAdapter{}, h)(context.Background(), testEvent{Path: "/a"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Body != "text/plain; charset=utf-8 nope\n" {
+				t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 nope\n")
+			}
+		})
+	}
+}
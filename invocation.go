@@ -0,0 +1,72 @@
+package funcserver
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Invocation is the metadata of the lambda invocation being handled, the runtime (eg lambdaruntime) adds it to the
+// request's context, see InvocationFromContext. If the runtime doesn't, Wrap adds one with only ColdStart & Deadline
+// set.
+type Invocation struct {
+	// RequestID is the lambda request id, it's not the id of the http request.
+	RequestID string
+
+	// InvokedFunctionArn is the ARN used to invoke the function, it includes the version or alias if there was one.
+	InvokedFunctionArn string
+
+	// FunctionVersion is the version of the function being executed, it's the version an alias points to.
+	FunctionVersion string
+
+	// TenantID is the tenant of the invocation, it's only set for functions with tenant isolation.
+	TenantID string
+
+	// Deadline is when lambda stops the invocation.
+	Deadline time.Time
+
+	// ColdStart is true for the first invocation in an execution environment.
+	ColdStart bool
+
+	// Event is the raw event, as received from lambda.
+	Event []byte
+}
+
+// FunctionArn returns the ARN of the function without the version or alias.
+func (inv *Invocation) FunctionArn() string {
+	arn, _ := inv.splitArn()
+	return arn
+}
+
+// Qualifier returns the version or alias the function was invoked with, "" if the function was invoked without one
+// ($LATEST).
+func (inv *Invocation) Qualifier() string {
+	_, q := inv.splitArn()
+	return q
+}
+
+// splitArn splits InvokedFunctionArn, arn:aws:lambda:region:account:function:name[:qualifier], into the function ARN
+// & the qualifier.
+func (inv *Invocation) splitArn() (string, string) {
+	parts := strings.SplitN(inv.InvokedFunctionArn, ":", 8)
+	if len(parts) < 8 {
+		return inv.InvokedFunctionArn, ""
+	}
+	return strings.Join(parts[:7], ":"), parts[7]
+}
+
+// RemainingTime returns the time left before the invocation's deadline.
+func (inv *Invocation) RemainingTime() time.Duration {
+	return time.Until(inv.Deadline)
+}
+
+// WithInvocation returns a copy of ctx that carries inv, it's used by runtimes.
+func WithInvocation(ctx context.Context, inv *Invocation) context.Context {
+	return context.WithValue(ctx, invocationContextKey, inv)
+}
+
+// InvocationFromContext returns the lambda invocation being handled, ok is false if the runtime didn't add it.
+func InvocationFromContext(ctx context.Context) (inv *Invocation, ok bool) {
+	inv, ok = ctx.Value(invocationContextKey).(*Invocation)
+	return inv, ok
+}
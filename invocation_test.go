@@ -0,0 +1,42 @@
+package funcserver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInvocation(t *testing.T) {
+	t.Run("arn", func(t *testing.T) {
+		for _, tc := range []struct {
+			arn, wantFunction, wantQualifier string
+		}{
+			{"arn:aws:lambda:eu-west-2:123456789012:function:test", "arn:aws:lambda:eu-west-2:123456789012:function:test", ""},
+			{"arn:aws:lambda:eu-west-2:123456789012:function:test:live", "arn:aws:lambda:eu-west-2:123456789012:function:test", "live"},
+			{"arn:aws:lambda:eu-west-2:123456789012:function:test:7", "arn:aws:lambda:eu-west-2:123456789012:function:test", "7"},
+		} {
+			inv := &Invocation{InvokedFunctionArn: tc.arn}
+			if inv.FunctionArn() != tc.wantFunction {
+				t.Errorf(`FunctionArn() = %q, want: %q`, inv.FunctionArn(), tc.wantFunction)
+			}
+			if inv.Qualifier() != tc.wantQualifier {
+				t.Errorf(`Qualifier() = %q, want: %q`, inv.Qualifier(), tc.wantQualifier)
+			}
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		if _, ok := InvocationFromContext(context.Background()); ok {
+			t.Error("InvocationFromContext() ok without an invocation")
+		}
+
+		inv := &Invocation{RequestID: "req-1", Deadline: time.Now().Add(time.Minute)}
+		got, ok := InvocationFromContext(WithInvocation(context.Background(), inv))
+		if !ok || got != inv {
+			t.Errorf(`InvocationFromContext() = %v, %t, want: %v, true`, got, ok, inv)
+		}
+		if d := got.RemainingTime(); d <= 0 || d > time.Minute {
+			t.Errorf(`RemainingTime() = %s, want: up to 1m`, d)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+/*
+Package lambdaruntime is a client for the AWS Lambda runtime API, it's what a lambda function uses to receive
+invocations and send responses.
+
+Here's some background info
+https://docs.aws.amazon.com/lambda/latest/dg/runtimes-api.html
+https://docs.aws.amazon.com/lambda/latest/dg/runtimes-custom.html#runtimes-custom-response-streaming.
+*/
+package lambdaruntime
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	apiVersion = "2018-06-01"
+
+	headerResponseMode = "Lambda-Runtime-Function-Response-Mode"
+
+	// sent as trailers when streaming a response
+	headerErrorType = "Lambda-Runtime-Function-Error-Type"
+	headerErrorBody = "Lambda-Runtime-Function-Error-Body"
+)
+
+// Client sends requests to the lambda runtime API.
+type Client struct {
+	// Concurrency is the number of invocations Serve & ServeStreaming handle at once, each polls the runtime API for
+	// the next invocation. 0 or 1 is one at a time, Start sets it from AWS_LAMBDA_MAX_CONCURRENCY which lambda sets
+	// when an execution environment can handle several invocations at once.
+	Concurrency int
+
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the runtime API at addr, lambda provides addr (host:port) via the
+// AWS_LAMBDA_RUNTIME_API environment variable.
+func NewClient(addr string) *Client {
+	return &Client{
+		baseURL: fmt.Sprintf("http://%s/%s/runtime", addr, apiVersion),
+		// no timeout, waiting for the next invocation blocks until there is one
+		httpClient: &http.Client{},
+	}
+}
+
+// errorResponse is the error format understood by the runtime API.
+type errorResponse struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorType    string `json:"errorType"`
+}
+
+func newErrorResponse(err error) errorResponse {
+	return errorResponse{
+		ErrorMessage: err.Error(),
+		ErrorType:    errorType(err),
+	}
+}
+
+// errorType returns the name of the (underlying) type of err, eg "errorString".
+func errorType(err error) string {
+	t := reflect.TypeOf(err)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// StreamResponse streams the response for the invocation requestID, everything fn writes to w is sent to the runtime
+// API as it's written (each write is sent as a separate chunk). If fn returns an error after it has started writing,
+// the error is reported to lambda via trailers, this is the only way to signal an error mid stream. Once reported, fn's
+// error is returned as is.
+func (c *Client) StreamResponse(ctx context.Context, requestID, contentType string, fn func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	body := &streamBody{pr: pr}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/invocation/%s/response", c.baseURL, requestID), body)
+	if err != nil {
+		return errors.Wrap(err, "unable to create response request")
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = -1 // chunked
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(headerResponseMode, "streaming")
+	req.Trailer = http.Header{
+		headerErrorType: nil,
+		headerErrorBody: nil,
+	}
+	body.trailer = req.Trailer
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := c.httpClient.Do(req)
+		done <- result{resp, err}
+	}()
+
+	fnErr := fn(pw)
+	body.err = fnErr
+	_ = pw.Close()
+
+	res := <-done
+	if res.err != nil {
+		return errors.Wrap(res.err, "unable to stream response")
+	}
+	defer res.resp.Body.Close() // nolint: errcheck
+	_, _ = io.Copy(ioutil.Discard, res.resp.Body)
+
+	if res.resp.StatusCode != http.StatusAccepted {
+		return errors.Errorf("unexpected status streaming response: %s", res.resp.Status)
+	}
+
+	return fnErr
+}
+
+// streamBody is the body of a streamed response, it sets the error trailers when the end of the body is read.
+// Trailers are sent once the body returns EOF, setting them from the reading goroutine avoids racing with the
+// transport which reads the trailer map when the request is sent.
+type streamBody struct {
+	pr      *io.PipeReader
+	trailer http.Header
+
+	// err is set before the pipe is closed
+	err error
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.pr.Read(p)
+	if err == io.EOF && b.err != nil {
+		payload, _ := json.Marshal(newErrorResponse(b.err))
+		b.trailer.Set(headerErrorType, errorType(b.err))
+		b.trailer.Set(headerErrorBody, base64.StdEncoding.EncodeToString(payload))
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	return b.pr.Close()
+}
+
+// Next blocks until the next invocation is available and returns it.
+func (c *Client) Next(ctx context.Context) (*Invocation, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/invocation/next", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create next invocation request")
+	}
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get next invocation")
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	payload, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read next invocation")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status getting next invocation: %s", resp.Status)
+	}
+
+	return newInvocation(resp.Header, payload)
+}
+
+// Respond sends the response for the invocation requestID.
+func (c *Client) Respond(ctx context.Context, requestID string, payload []byte) error {
+	return c.post(ctx, fmt.Sprintf("/invocation/%s/response", requestID), nil, payload)
+}
+
+// InvocationError reports that the invocation requestID failed with err.
+func (c *Client) InvocationError(ctx context.Context, requestID string, err error) error {
+	return c.postError(ctx, fmt.Sprintf("/invocation/%s/error", requestID), err)
+}
+
+// InitError reports that the function failed to initialise, lambda restarts the execution environment after it is
+// called so the process should exit.
+func (c *Client) InitError(ctx context.Context, err error) error {
+	return c.postError(ctx, "/init/error", err)
+}
+
+func (c *Client) postError(ctx context.Context, path string, err error) error {
+	payload, mErr := json.Marshal(newErrorResponse(err))
+	if mErr != nil {
+		return errors.Wrap(mErr, "unable to marshal error")
+	}
+	h := http.Header{headerErrorType: {errorType(err)}}
+	return c.post(ctx, path, h, payload)
+}
+
+func (c *Client) post(ctx context.Context, path string, h http.Header, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrapf(err, "unable to create request %s", path)
+	}
+	for k, vv := range h {
+		req.Header[k] = vv
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "unable to post %s", path)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusAccepted {
+		return errors.Errorf("unexpected status posting %s: %s", path, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package lambdaruntime
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// fakeStreamingRuntime is a fake of the runtime API's streaming response endpoint, each body line received is sent
+// on lines as soon as it arrives.
+type fakeStreamingRuntime struct {
+	t       *testing.T
+	lines   chan string
+	header  http.Header
+	trailer http.Header
+	path    string
+}
+
+func newFakeStreamingRuntime(t *testing.T) (*fakeStreamingRuntime, *httptest.Server) {
+	f := &fakeStreamingRuntime{t: t, lines: make(chan string, 10)}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeStreamingRuntime) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.path = r.URL.Path
+	f.header = r.Header
+	s := bufio.NewScanner(r.Body)
+	for s.Scan() {
+		f.lines <- s.Text()
+	}
+	close(f.lines)
+	f.trailer = r.Trailer
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func TestStreamResponse(t *testing.T) {
+	t.Run("chunks sent as written", func(t *testing.T) {
+		f, srv := newFakeStreamingRuntime(t)
+		defer srv.Close()
+
+		c := NewClient(strings.TrimPrefix(srv.URL, "http://"))
+		err := c.StreamResponse(context.Background(), "req-1", "text/plain", func(w io.Writer) error {
+			for _, l := range []string{"one", "two"} {
+				if _, err := io.WriteString(w, l+"\n"); err != nil {
+					return err
+				}
+				// the line must be received before the next write is made
+				if got := <-f.lines; got != l {
+					t.Errorf(`line = %q, want: %q`, got, l)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.path != "/2018-06-01/runtime/invocation/req-1/response" {
+			t.Errorf(`path = %q, want: %q`, f.path, "/2018-06-01/runtime/invocation/req-1/response")
+		}
+		if f.header.Get(headerResponseMode) != "streaming" {
+			t.Errorf(`header %s = %q, want: %q`, headerResponseMode, f.header.Get(headerResponseMode), "streaming")
+		}
+		if f.header.Get("Content-Type") != "text/plain" {
+			t.Errorf(`header Content-Type = %q, want: %q`, f.header.Get("Content-Type"), "text/plain")
+		}
+		if f.trailer.Get(headerErrorType) != "" {
+			t.Errorf(`trailer %s = %q, want: ""`, headerErrorType, f.trailer.Get(headerErrorType))
+		}
+	})
+
+	t.Run("error mid stream", func(t *testing.T) {
+		f, srv := newFakeStreamingRuntime(t)
+		defer srv.Close()
+
+		c := NewClient(strings.TrimPrefix(srv.URL, "http://"))
+		err := c.StreamResponse(context.Background(), "req-1", "text/plain", func(w io.Writer) error {
+			_, _ = io.WriteString(w, "partial\n")
+			return errors.New("boom")
+		})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		if f.trailer.Get(headerErrorType) != "fundamental" {
+			t.Errorf(`trailer %s = %q, want: %q`, headerErrorType, f.trailer.Get(headerErrorType), "fundamental")
+		}
+		data, err := base64.StdEncoding.DecodeString(f.trailer.Get(headerErrorBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var er errorResponse
+		if err := json.Unmarshal(data, &er); err != nil {
+			t.Fatal(err)
+		}
+		if er.ErrorMessage != "boom" {
+			t.Errorf(`er.ErrorMessage = %q, want: %q`, er.ErrorMessage, "boom")
+		}
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(ioutil.Discard, r.Body)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}))
+		defer srv.Close()
+
+		c := NewClient(strings.TrimPrefix(srv.URL, "http://"))
+		err := c.StreamResponse(context.Background(), "req-1", "text/plain", func(w io.Writer) error {
+			_, err := io.WriteString(w, "too big")
+			return err
+		})
+		if err == nil {
+			t.Error("expected error, got nil")
+		}
+	})
+}
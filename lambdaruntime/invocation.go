@@ -0,0 +1,85 @@
+package lambdaruntime
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Invocation holds an event received from the runtime API along with its metadata. This is accessed via
+// InvocationFromContext.
+// https://docs.aws.amazon.com/lambda/latest/dg/runtimes-api.html#runtimes-api-next
+type Invocation struct {
+	RequestID          string
+	Deadline           time.Time
+	InvokedFunctionArn string
+	TraceID            string
+	ClientContext      string
+	CognitoIdentity    string
+	TenantID           string
+
+	// ColdStart is true for the first invocation in the execution environment.
+	ColdStart bool
+
+	// Payload is the raw event.
+	Payload []byte
+}
+
+// contextKey is the type of the context keys private to this package.
+type contextKey int
+
+const invocationContextKey contextKey = iota
+
+// warm is set once the execution environment has started handling an invocation.
+var warm atomic.Bool
+
+func newInvocation(h http.Header, payload []byte) (*Invocation, error) {
+	inv := &Invocation{
+		RequestID:          h.Get("Lambda-Runtime-Aws-Request-Id"),
+		InvokedFunctionArn: h.Get("Lambda-Runtime-Invoked-Function-Arn"),
+		TraceID:            h.Get("Lambda-Runtime-Trace-Id"),
+		ClientContext:      h.Get("Lambda-Runtime-Client-Context"),
+		CognitoIdentity:    h.Get("Lambda-Runtime-Cognito-Identity"),
+		TenantID:           h.Get("Lambda-Runtime-Aws-Tenant-Id"),
+		Payload:            payload,
+	}
+	if inv.RequestID == "" {
+		return nil, errors.New("invocation has no request id")
+	}
+
+	ms, err := strconv.ParseInt(h.Get("Lambda-Runtime-Deadline-Ms"), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse invocation deadline")
+	}
+	inv.Deadline = time.Unix(0, ms*int64(time.Millisecond))
+
+	return inv, nil
+}
+
+// InvocationFromContext returns the invocation being handled, funcserver.InvocationFromContext returns the runtime
+// independent part of it.
+func InvocationFromContext(ctx context.Context) (*Invocation, bool) {
+	inv, ok := ctx.Value(invocationContextKey).(*Invocation)
+	return inv, ok
+}
+
+// withInvocation returns a copy of ctx that carries inv, both as an Invocation & a funcserver.Invocation.
+func withInvocation(ctx context.Context, inv *Invocation) context.Context {
+	ctx = context.WithValue(ctx, invocationContextKey, inv)
+	return funcserver.WithInvocation(ctx, &funcserver.Invocation{
+		RequestID:          inv.RequestID,
+		InvokedFunctionArn: inv.InvokedFunctionArn,
+		FunctionVersion:    os.Getenv("AWS_LAMBDA_FUNCTION_VERSION"),
+		TenantID:           inv.TenantID,
+		Deadline:           inv.Deadline,
+		ColdStart:          inv.ColdStart,
+		Event:              inv.Payload,
+	})
+}
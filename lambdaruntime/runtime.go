@@ -0,0 +1,199 @@
+package lambdaruntime
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// Handler is the interface that handles a raw invocation payload, it's the same as the aws-lambda-go lambda.Handler
+// interface.
+type Handler interface {
+	Invoke(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as a Handler.
+type HandlerFunc func(ctx context.Context, payload []byte) ([]byte, error)
+
+// Invoke calls f(ctx, payload).
+func (f HandlerFunc) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	return f(ctx, payload)
+}
+
+// StreamingHandler is the interface that handles a raw invocation payload and streams the response to w. Typed
+// funcserver.StreamingHandlers implement it, the payload is unmarshalled straight into the event type.
+type StreamingHandler interface {
+	InvokeStream(ctx context.Context, payload []byte, w io.Writer) error
+}
+
+// NewHandler converts a funcserver.RequestHandler into a Handler, the payload is unmarshalled into a map and the
+// response marshalled as json. Typed funcserver.Handlers implement Handler without conversion.
+func NewHandler(h funcserver.RequestHandler) Handler {
+	return h
+}
+
+// Start runs h in the lambda runtime loop, it's the provided.al2023 (or any other custom runtime) equivalent of
+// aws-lambda-go's lambda.Start, Start never returns.
+//
+// The binary must be named bootstrap and be in the root of the deployment package.
+// https://docs.aws.amazon.com/lambda/latest/dg/golang-package.html
+func Start(h funcserver.RequestHandler) {
+	StartHandler(NewHandler(h))
+}
+
+// StartHandler runs h in the lambda runtime loop, see Start.
+func StartHandler(h Handler) {
+	start(func(ctx context.Context, c *Client) error {
+		return c.Serve(ctx, h)
+	})
+}
+
+// StartInit calls init to create the handler, if init returns an error it's reported to lambda as an init error and
+// the process exits. Otherwise the handler is run in the lambda runtime loop, see Start.
+func StartInit(init func(ctx context.Context) (Handler, error)) {
+	start(func(ctx context.Context, c *Client) error {
+		h, err := init(ctx)
+		if err != nil {
+			if rErr := c.InitError(ctx, err); rErr != nil {
+				return rErr
+			}
+			return errors.Wrap(err, "init failed")
+		}
+		return c.Serve(ctx, h)
+	})
+}
+
+// StartStreaming runs h in the lambda runtime loop streaming each response to the runtime API with the given content
+// type, see Start. The function must be invoked in the RESPONSE_STREAM mode.
+//
+//	lambdaruntime.StartStreaming(httpapilambda.TypedStreamingHandler(router, opts), httpapilambda.StreamingContentType)
+func StartStreaming(h StreamingHandler, contentType string) {
+	start(func(ctx context.Context, c *Client) error {
+		return c.ServeStreaming(ctx, h, contentType)
+	})
+}
+
+func start(run func(ctx context.Context, c *Client) error) {
+	addr := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if addr == "" {
+		log.Fatal("AWS_LAMBDA_RUNTIME_API not set, not running in lambda?")
+	}
+
+	c := NewClient(addr)
+	if n, err := strconv.Atoi(os.Getenv("AWS_LAMBDA_MAX_CONCURRENCY")); err == nil {
+		c.Concurrency = n
+	}
+
+	if err := run(context.Background(), c); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Serve gets invocations from the runtime API, calls h for each one and reports the result. It returns when ctx is
+// done or the runtime API can't be reached, errors returned by h are reported as invocation errors.
+func (c *Client) Serve(ctx context.Context, h Handler) error {
+	return c.serve(ctx, func(ctx context.Context, inv *Invocation) error {
+		resp, err := c.invoke(ctx, inv, h.Invoke)
+		if err != nil {
+			return c.InvocationError(ctx, inv.RequestID, err)
+		}
+		return c.Respond(ctx, inv.RequestID, resp)
+	})
+}
+
+// ServeStreaming is the same as Serve, but the response of each invocation is streamed with the given content type,
+// see StreamResponse. Errors returned by h, including a payload it can't unmarshal, are sent in the response trailers.
+func (c *Client) ServeStreaming(ctx context.Context, h StreamingHandler, contentType string) error {
+	return c.serve(ctx, func(ctx context.Context, inv *Invocation) error {
+		var hErr error
+		err := c.StreamResponse(ctx, inv.RequestID, contentType, func(w io.Writer) error {
+			_, hErr = c.invoke(ctx, inv, func(ctx context.Context, payload []byte) ([]byte, error) {
+				return nil, h.InvokeStream(ctx, payload, w)
+			})
+			return hErr
+		})
+		// handler errors have already been sent to lambda in the response trailers
+		if err != nil && err == hErr {
+			return nil
+		}
+		return err
+	})
+}
+
+// serve polls the runtime API for invocations with Concurrency goroutines, it returns the first error once they've all
+// stopped.
+func (c *Client) serve(ctx context.Context, handle func(ctx context.Context, inv *Invocation) error) error {
+	n := c.Concurrency
+	if n < 1 {
+		n = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			err := c.poll(ctx, handle)
+			// stop the other pollers
+			cancel()
+			errs <- err
+		}()
+	}
+
+	var err error
+	for i := 0; i < n; i++ {
+		if pErr := <-errs; pErr != nil && err == nil {
+			err = pErr
+		}
+	}
+	return err
+}
+
+// poll handles invocations one at a time until ctx is done or there's an error.
+func (c *Client) poll(ctx context.Context, handle func(ctx context.Context, inv *Invocation) error) error {
+	for {
+		inv, err := c.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := handle(ctx, inv); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// invoke calls f with a context that carries the invocation and its deadline, a panic is returned as an error.
+func (c *Client) invoke(ctx context.Context, inv *Invocation, f HandlerFunc) (resp []byte, err error) {
+	ctx, cancel := context.WithDeadline(ctx, inv.Deadline)
+	defer cancel()
+	inv.ColdStart = !warm.Swap(true)
+	ctx = withInvocation(ctx, inv)
+
+	// read by the x-ray sdk, it's process wide so it's only set when invocations are handled one at a time, otherwise
+	// the trace id is only available from the context (see InvocationFromContext)
+	if c.Concurrency <= 1 {
+		_ = os.Setenv("_X_AMZN_TRACE_ID", inv.TraceID)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = funcserver.PanicError(r)
+		}
+	}()
+
+	return f(ctx, inv.Payload)
+}
@@ -0,0 +1,321 @@
+package lambdaruntime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/j0hnsmith/funcserver"
+)
+
+// fakeResult is a response or error posted to the fake runtime API.
+type fakeResult struct {
+	path      string
+	errorType string
+	body      string
+}
+
+// fakeRuntime is an in-process fake of the runtime API, events sent on invocations are handed out by
+// /invocation/next, everything posted back is sent on results.
+type fakeRuntime struct {
+	invocations chan string
+	results     chan fakeResult
+
+	mu        sync.Mutex
+	requestID int
+}
+
+func newFakeRuntime() (*fakeRuntime, *httptest.Server) {
+	f := &fakeRuntime{invocations: make(chan string), results: make(chan fakeResult, 10)}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeRuntime) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/2018-06-01/runtime/invocation/next" {
+		select {
+		case payload := <-f.invocations:
+			f.mu.Lock()
+			f.requestID++
+			requestID := f.requestID
+			f.mu.Unlock()
+			deadline := time.Now().Add(time.Minute).UnixNano() / int64(time.Millisecond)
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", fmt.Sprintf("req-%d", requestID))
+			w.Header().Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(deadline, 10))
+			w.Header().Set("Lambda-Runtime-Invoked-Function-Arn", "arn:aws:lambda:eu-west-2:123456789012:function:test")
+			w.Header().Set("Lambda-Runtime-Trace-Id", "Root=1-5bef4de7-ad49b0e87f6ef6c87fc2e700")
+			_, _ = w.Write([]byte(payload))
+		case <-r.Context().Done():
+		}
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	errorType := r.Header.Get(headerErrorType)
+	if errorType == "" {
+		// streamed responses report errors in the trailers
+		errorType = r.Trailer.Get(headerErrorType)
+	}
+	f.results <- fakeResult{
+		path:      strings.TrimPrefix(r.URL.Path, "/2018-06-01/runtime"),
+		errorType: errorType,
+		body:      string(body),
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func TestServe(t *testing.T) { // nolint: gocyclo
+	f, srv := newFakeRuntime()
+	defer srv.Close()
+
+	h := funcserver.RequestHandler(func(ctx context.Context, r map[string]interface{}) (interface{}, error) {
+		inv, ok := InvocationFromContext(ctx)
+		if !ok {
+			return nil, errors.New("no invocation in context")
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("no deadline")
+		}
+		fi, ok := funcserver.InvocationFromContext(ctx)
+		if !ok || fi.RequestID != inv.RequestID || string(fi.Event) != string(inv.Payload) {
+			return nil, errors.New("no funcserver invocation in context")
+		}
+		switch r["action"] {
+		case "error":
+			return nil, errors.New("handler failed")
+		case "panic":
+			panic("handler panicked")
+		}
+		return map[string]string{"requestID": inv.RequestID, "echo": r["action"].(string), "coldStart": strconv.FormatBool(fi.ColdStart)}, nil
+	})
+	warm.Store(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- NewClient(strings.TrimPrefix(srv.URL, "http://")).Serve(ctx, NewHandler(h))
+	}()
+
+	t.Run("response", func(t *testing.T) {
+		f.invocations <- `{"action":"hello"}`
+		res := <-f.results
+		if res.path != "/invocation/req-1/response" {
+			t.Errorf(`res.path = %q, want: %q`, res.path, "/invocation/req-1/response")
+		}
+		var body map[string]string
+		if err := json.Unmarshal([]byte(res.body), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["echo"] != "hello" || body["requestID"] != "req-1" || body["coldStart"] != "true" {
+			t.Errorf(`body = %v, want: echo=hello requestID=req-1 coldStart=true`, body)
+		}
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		f.invocations <- `{"action":"error"}`
+		res := <-f.results
+		if res.path != "/invocation/req-2/error" {
+			t.Errorf(`res.path = %q, want: %q`, res.path, "/invocation/req-2/error")
+		}
+		if res.errorType != "fundamental" {
+			t.Errorf(`res.errorType = %q, want: %q`, res.errorType, "fundamental")
+		}
+		if !strings.Contains(res.body, "handler failed") {
+			t.Errorf(`res.body = %q, want to contain: %q`, res.body, "handler failed")
+		}
+	})
+
+	t.Run("handler panic", func(t *testing.T) {
+		f.invocations <- `{"action":"panic"}`
+		res := <-f.results
+		if res.path != "/invocation/req-3/error" {
+			t.Errorf(`res.path = %q, want: %q`, res.path, "/invocation/req-3/error")
+		}
+		if !strings.Contains(res.body, "handler panicked") {
+			t.Errorf(`res.body = %q, want to contain: %q`, res.body, "handler panicked")
+		}
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		f.invocations <- `not json`
+		res := <-f.results
+		if res.path != "/invocation/req-4/error" {
+			t.Errorf(`res.path = %q, want: %q`, res.path, "/invocation/req-4/error")
+		}
+	})
+
+	t.Run("warm start", func(t *testing.T) {
+		f.invocations <- `{"action":"again"}`
+		res := <-f.results
+		if !strings.Contains(res.body, `"coldStart":"false"`) {
+			t.Errorf(`res.body = %q, want: coldStart false`, res.body)
+		}
+	})
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Serve() = %v, want: nil", err)
+	}
+}
+
+func TestServeConcurrency(t *testing.T) {
+	f, srv := newFakeRuntime()
+	defer srv.Close()
+
+	// each invocation waits for the other, they can only finish if they're handled at once
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, payload []byte) ([]byte, error) {
+		inv, _ := InvocationFromContext(ctx)
+		started <- inv.TraceID
+		<-release
+		return payload, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		c := NewClient(strings.TrimPrefix(srv.URL, "http://"))
+		c.Concurrency = 2
+		served <- c.Serve(ctx, h)
+	}()
+
+	go func() {
+		f.invocations <- `"a"`
+		f.invocations <- `"b"`
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case traceID := <-started:
+			if traceID != "Root=1-5bef4de7-ad49b0e87f6ef6c87fc2e700" {
+				t.Errorf(`traceID = %q, want: %q`, traceID, "Root=1-5bef4de7-ad49b0e87f6ef6c87fc2e700")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("invocations weren't handled at once")
+		}
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		<-f.results
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Serve() = %v, want: nil", err)
+	}
+}
+
+func TestServeStreaming(t *testing.T) {
+	f, srv := newFakeRuntime()
+	defer srv.Close()
+
+	h := funcserver.StreamingRequestHandler(func(ctx context.Context, r map[string]interface{}, w io.Writer) error {
+		if r["action"] == "error" {
+			return errors.New("handler failed")
+		}
+		_, err := io.WriteString(w, "streamed")
+		return err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- NewClient(strings.TrimPrefix(srv.URL, "http://")).ServeStreaming(ctx, h, "text/plain")
+	}()
+
+	f.invocations <- `{"action":"stream"}`
+	res := <-f.results
+	if res.path != "/invocation/req-1/response" {
+		t.Errorf(`res.path = %q, want: %q`, res.path, "/invocation/req-1/response")
+	}
+	if res.body != "streamed" {
+		t.Errorf(`res.body = %q, want: %q`, res.body, "streamed")
+	}
+
+	// handler errors are sent as trailers and don't stop the loop
+	f.invocations <- `{"action":"error"}`
+	res = <-f.results
+	if res.path != "/invocation/req-2/response" {
+		t.Errorf(`res.path = %q, want: %q`, res.path, "/invocation/req-2/response")
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("ServeStreaming() = %v, want: nil", err)
+	}
+}
+
+func TestServeStreamingTyped(t *testing.T) {
+	f, srv := newFakeRuntime()
+	defer srv.Close()
+
+	type event struct {
+		Action string `json:"action"`
+	}
+	h := funcserver.StreamingHandler[event](func(ctx context.Context, e event, w io.Writer) error {
+		_, err := io.WriteString(w, "streamed "+e.Action)
+		return err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- NewClient(strings.TrimPrefix(srv.URL, "http://")).ServeStreaming(ctx, h, "text/plain")
+	}()
+
+	f.invocations <- `{"action":"stream"}`
+	res := <-f.results
+	if res.body != "streamed stream" {
+		t.Errorf(`res.body = %q, want: %q`, res.body, "streamed stream")
+	}
+
+	// a payload that can't be unmarshalled is reported in the trailers
+	f.invocations <- `not json`
+	res = <-f.results
+	if res.errorType != "EventError" {
+		t.Errorf(`res.errorType = %q, want: %q`, res.errorType, "EventError")
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("ServeStreaming() = %v, want: nil", err)
+	}
+}
+
+func TestServeRuntimeUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	err := NewClient(strings.TrimPrefix(srv.URL, "http://")).Serve(context.Background(), NewHandler(nil))
+	if err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+func TestInitError(t *testing.T) {
+	f, srv := newFakeRuntime()
+	defer srv.Close()
+
+	err := NewClient(strings.TrimPrefix(srv.URL, "http://")).InitError(context.Background(), errors.New("no config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-f.results
+	if res.path != "/init/error" {
+		t.Errorf(`res.path = %q, want: %q`, res.path, "/init/error")
+	}
+	if !strings.Contains(res.body, "no config") {
+		t.Errorf(`res.body = %q, want to contain: %q`, res.body, "no config")
+	}
+}
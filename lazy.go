@@ -0,0 +1,88 @@
+package funcserver
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// LazyHandler is a http.Handler that builds the handler it serves requests with on first use, so that building it
+// (eg connecting to a database) can't crash the function in main. If the build fails the request is answered with a
+// 503 Service Unavailable by the adapter's Options.ErrorHandler and the error is logged, the next request tries again.
+type LazyHandler struct {
+	build func(ctx context.Context) (http.Handler, error)
+
+	mu      sync.Mutex
+	handler atomic.Pointer[builtHandler]
+}
+
+// builtHandler boxes the built handler, atomic.Pointer needs a concrete type.
+type builtHandler struct {
+	http.Handler
+}
+
+// NewLazyHandler returns a LazyHandler that builds its handler with build.
+func NewLazyHandler(build func(ctx context.Context) (http.Handler, error)) *LazyHandler {
+	return &LazyHandler{build: build}
+}
+
+// Init builds the handler now if it hasn't been built, eg during the function's init phase. The error is logged, as
+// it is when a request builds the handler.
+func (lh *LazyHandler) Init(ctx context.Context) error {
+	_, err := lh.get(ctx)
+	return err
+}
+
+// ServeHTTP builds the handler if needed and serves r with it.
+func (lh *LazyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, err := lh.get(r.Context())
+	if err != nil {
+		errorHandlerFromContext(r.Context())(w, r, NewHTTPError(http.StatusServiceUnavailable, "", err))
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+func (lh *LazyHandler) get(ctx context.Context) (http.Handler, error) {
+	if b := lh.handler.Load(); b != nil {
+		return b.Handler, nil
+	}
+
+	lh.mu.Lock()
+	defer lh.mu.Unlock()
+	if b := lh.handler.Load(); b != nil {
+		return b.Handler, nil
+	}
+
+	h, err := lh.build(ctx)
+	if err == nil && h == nil {
+		err = errors.New("no handler built")
+	}
+	if err != nil {
+		log.Printf("funcserver: unable to build handler: %v", err)
+		return nil, err
+	}
+	lh.handler.Store(&builtHandler{h})
+	return h, nil
+}
+
+// warm is set once the execution environment has started handling an invocation, it's used when the runtime doesn't
+// add the Invocation to the context.
+var warm atomic.Bool
+
+// withColdStart returns ctx with the invocation being handled, adding one if the runtime didn't, with ColdStart set if
+// it's the first invocation in the execution environment.
+func withColdStart(ctx context.Context) context.Context {
+	first := !warm.Swap(true)
+	if _, ok := InvocationFromContext(ctx); ok {
+		return ctx
+	}
+
+	inv := &Invocation{ColdStart: first}
+	inv.Deadline, _ = ctx.Deadline()
+	return WithInvocation(ctx, inv)
+}
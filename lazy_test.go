@@ -0,0 +1,143 @@
+package funcserver
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLazyHandler(t *testing.T) {
+	builds := 0
+	lh := NewLazyHandler(func(ctx context.Context) (http.Handler, error) {
+		builds++
+		if builds == 1 {
+			return nil, errors.New("database unavailable")
+		}
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte("built"))
+		}), nil
+	})
+	h := Wrap[testEvent, testResponse](testAdapter{}, lh)
+
+	resp, err := h(context.Background(), testEvent{Path: "/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "text/plain; charset=utf-8 Service Unavailable\n" {
+		t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 Service Unavailable\n")
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err = h(context.Background(), testEvent{Path: "/a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "text/plain; charset=utf-8 built" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 built")
+		}
+	}
+	if builds != 2 {
+		t.Errorf(`builds = %d, want: %d`, builds, 2)
+	}
+}
+
+func TestColdStart(t *testing.T) {
+	t.Run("invocation", func(t *testing.T) {
+		warm.Store(false)
+
+		var hooks []bool
+		opts := Options{OnColdStart: []func(ctx context.Context){
+			func(ctx context.Context) {
+				inv, _ := InvocationFromContext(ctx)
+				hooks = append(hooks, inv.ColdStart)
+			},
+		}}
+		var coldStarts []bool
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			inv, ok := InvocationFromContext(req.Context())
+			coldStarts = append(coldStarts, ok && inv.ColdStart)
+		}), opts)
+
+		for i := 0; i < 2; i++ {
+			if _, err := h(context.Background(), testEvent{Path: "/a"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(coldStarts) != 2 || !coldStarts[0] || coldStarts[1] {
+			t.Errorf(`coldStarts = %v, want: [true false]`, coldStarts)
+		}
+		if len(hooks) != 1 || !hooks[0] {
+			t.Errorf(`hooks = %v, want: [true]`, hooks)
+		}
+
+		// the runtime's invocation is used if there is one
+		ctx := WithInvocation(context.Background(), &Invocation{RequestID: "req-1", ColdStart: true})
+		if _, err := h(ctx, testEvent{Path: "/a"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(coldStarts) != 3 || !coldStarts[2] {
+			t.Errorf(`coldStarts = %v, want: [true false true]`, coldStarts)
+		}
+		if len(hooks) != 1 {
+			t.Errorf(`len(hooks) = %d, want: %d`, len(hooks), 1)
+		}
+	})
+
+	t.Run("per handler", func(t *testing.T) {
+		var hooks []string
+		hook := func(name string) Options {
+			return Options{OnColdStart: []func(ctx context.Context){
+				func(ctx context.Context) { hooks = append(hooks, name) },
+			}}
+		}
+		noop := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+		a := WrapWithOptions[testEvent, testResponse](testAdapter{}, noop, hook("a"))
+		b := WrapWithOptions[testEvent, testResponse](testAdapter{}, noop, hook("b"))
+
+		for _, h := range []Handler[testEvent, testResponse]{a, b, a, b} {
+			if _, err := h(context.Background(), testEvent{Path: "/a"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(hooks, []string{"a", "b"}) {
+			t.Errorf(`hooks = %q, want: %q`, hooks, []string{"a", "b"})
+		}
+	})
+
+	t.Run("concurrent invocations wait", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var warmed atomic.Bool
+		opts := Options{OnColdStart: []func(ctx context.Context){
+			func(ctx context.Context) {
+				close(started)
+				<-release
+				warmed.Store(true)
+			},
+		}}
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if !warmed.Load() {
+				t.Error("handler called before the OnColdStart hooks finished")
+			}
+		}), opts)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := h(context.Background(), testEvent{Path: "/a"}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		<-started
+		close(release)
+		wg.Wait()
+	})
+}
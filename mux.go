@@ -0,0 +1,111 @@
+package funcserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// EventSource identifies the service (and payload format) an event came from.
+type EventSource string
+
+// The event sources a Mux can detect.
+const (
+	// SourceUnknown is any event that isn't a http event, eg a scheduled (EventBridge) event.
+	SourceUnknown EventSource = "unknown"
+	// SourceALB is an application load balancer event, see alblambda.
+	SourceALB EventSource = "alb"
+	// SourceAPIGatewayREST is an API Gateway REST API (or v1.0 payload format) event, see apigwlambda.
+	SourceAPIGatewayREST EventSource = "apigateway-rest"
+	// SourceHTTPAPI is an API Gateway HTTP API v2.0 payload format or function URL event, see httpapilambda.
+	SourceHTTPAPI EventSource = "apigateway-http"
+)
+
+// Invoker is the interface that handles a raw event payload, it's implemented by Handler (and so RequestHandler) and
+// is the same as the lambdaruntime.Handler interface.
+type Invoker interface {
+	Invoke(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// UnrecognisedEventError is returned by Mux.Invoke when there's no handler for an event.
+type UnrecognisedEventError struct {
+	Source EventSource
+}
+
+func (e *UnrecognisedEventError) Error() string {
+	if e.Source == SourceUnknown {
+		return "unrecognised event, not from a known http event source and no fallback handler"
+	}
+	return fmt.Sprintf("no handler for %s events", e.Source)
+}
+
+// eventProbe is the minimum of each event format needed to tell them apart.
+type eventProbe struct {
+	Version        string `json:"version"`
+	HTTPMethod     string `json:"httpMethod"`
+	RequestContext struct {
+		ELB   json.RawMessage `json:"elb"`
+		HTTP  json.RawMessage `json:"http"`
+		APIID string          `json:"apiId"`
+	} `json:"requestContext"`
+}
+
+// DetectEventSource inspects a raw payload to find which event source it came from. Payloads that aren't json objects
+// or aren't recognised are SourceUnknown.
+func DetectEventSource(payload []byte) EventSource {
+	var p eventProbe
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return SourceUnknown
+	}
+
+	switch {
+	case len(p.RequestContext.ELB) > 0:
+		return SourceALB
+	case p.Version == "2.0" && len(p.RequestContext.HTTP) > 0:
+		return SourceHTTPAPI
+	case p.HTTPMethod != "" && p.RequestContext.APIID != "":
+		return SourceAPIGatewayREST
+	}
+	return SourceUnknown
+}
+
+// NewMux returns an empty Mux.
+func NewMux() *Mux {
+	return &Mux{handlers: make(map[EventSource]Invoker)}
+}
+
+// Mux sends each event to the handler registered for its event source, this allows one function to be attached to
+// eg an ALB, an API Gateway stage and a scheduled rule. It implements the lambdaruntime.Handler interface.
+//
+//	mux := funcserver.NewMux()
+//	mux.Handle(funcserver.SourceALB, alblambda.NewHandler(router, alblambda.Options{}))
+//	mux.Handle(funcserver.SourceHTTPAPI, httpapilambda.TypedHandler(router, httpapilambda.Options{}))
+//	mux.Fallback(funcserver.RequestHandler(scheduled))
+//	lambdaruntime.StartHandler(mux)
+type Mux struct {
+	handlers map[EventSource]Invoker
+	fallback Invoker
+}
+
+// Handle registers h for events from source, any Handler (including a RequestHandler) can be used.
+func (m *Mux) Handle(source EventSource, h Invoker) {
+	m.handlers[source] = h
+}
+
+// Fallback registers h for events that don't have a handler for their event source, including SourceUnknown events.
+func (m *Mux) Fallback(h Invoker) {
+	m.fallback = h
+}
+
+// Invoke detects the event source of payload and calls the matching handler. If there isn't one, the fallback
+// handler is called, or a *UnrecognisedEventError returned if there's no fallback.
+func (m *Mux) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	source := DetectEventSource(payload)
+	if h, ok := m.handlers[source]; ok {
+		return h.Invoke(ctx, payload)
+	}
+	if m.fallback != nil {
+		return m.fallback.Invoke(ctx, payload)
+	}
+	return nil, &UnrecognisedEventError{Source: source}
+}
@@ -0,0 +1,84 @@
+package funcserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	albEvent      = []byte(`{"requestContext":{"elb":{"targetGroupArn":"arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/lambda/49e9d65c45c6791a"}},"httpMethod":"GET","path":"/lambda"}`)
+	restEvent     = []byte(`{"resource":"/{proxy+}","path":"/hello","httpMethod":"GET","requestContext":{"apiId":"1234567890","stage":"prod"}}`)
+	httpAPIEvent  = []byte(`{"version":"2.0","routeKey":"$default","rawPath":"/hello","requestContext":{"apiId":"api-id","http":{"method":"GET","path":"/hello"}}}`)
+	scheduleEvent = []byte(`{"version":"0","id":"53dc4d37","detail-type":"Scheduled Event","source":"aws.events","detail":{}}`)
+)
+
+func TestDetectEventSource(t *testing.T) {
+	for name, tc := range map[string]struct {
+		payload []byte
+		want    EventSource
+	}{
+		"alb":        {albEvent, SourceALB},
+		"rest":       {restEvent, SourceAPIGatewayREST},
+		"http api":   {httpAPIEvent, SourceHTTPAPI},
+		"scheduled":  {scheduleEvent, SourceUnknown},
+		"not object": {[]byte(`"hello"`), SourceUnknown},
+		"not json":   {[]byte(`hello`), SourceUnknown},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := DetectEventSource(tc.payload); got != tc.want {
+				t.Errorf(`DetectEventSource() = %q, want: %q`, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMux(t *testing.T) {
+	named := func(name string) RequestHandler {
+		return func(ctx context.Context, r map[string]interface{}) (interface{}, error) {
+			return name, nil
+		}
+	}
+
+	mux := NewMux()
+	mux.Handle(SourceALB, named("alb"))
+	mux.Handle(SourceHTTPAPI, named("http"))
+
+	t.Run("routes by source", func(t *testing.T) {
+		for payload, want := range map[string]string{
+			string(albEvent):     `"alb"`,
+			string(httpAPIEvent): `"http"`,
+		} {
+			data, err := mux.Invoke(context.Background(), []byte(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != want {
+				t.Errorf(`Invoke() = %s, want: %s`, data, want)
+			}
+		}
+	})
+
+	t.Run("unrecognised", func(t *testing.T) {
+		_, err := mux.Invoke(context.Background(), restEvent)
+		uErr, ok := errors.Cause(err).(*UnrecognisedEventError)
+		if !ok {
+			t.Fatalf(`err = %v, want: *UnrecognisedEventError`, err)
+		}
+		if uErr.Source != SourceAPIGatewayREST {
+			t.Errorf(`uErr.Source = %q, want: %q`, uErr.Source, SourceAPIGatewayREST)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		mux.Fallback(named("fallback"))
+		data, err := mux.Invoke(context.Background(), scheduleEvent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `"fallback"` {
+			t.Errorf(`Invoke() = %s, want: %s`, data, `"fallback"`)
+		}
+	})
+}
@@ -0,0 +1,323 @@
+package funcserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrResponseFinalised is returned by the ResponseRecorder methods that write the response once the response has been
+// finalised by Result, eg by a goroutine the handler started that's still writing after ServeHTTP returned.
+var ErrResponseFinalised = errors.New("funcserver: write after the response was finalised")
+
+// RecordedResponse is a response recorded by a ResponseRecorder.
+type RecordedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// NewResponseRecorder returns an initialised ResponseRecorder.
+func NewResponseRecorder() *ResponseRecorder {
+	rw := &ResponseRecorder{
+		header:        make(http.Header),
+		handlerHeader: make(http.Header),
+	}
+	return rw
+}
+
+var (
+	_ http.Flusher  = &ResponseRecorder{}
+	_ http.Hijacker = &ResponseRecorder{}
+	_ io.ReaderFrom = &ResponseRecorder{}
+)
+
+// ResponseRecorder is a http.ResponseWriter that buffers the response written by a http.Handler so that it can be
+// encoded into a provider's response event. Unlike httptest.ResponseRecorder it behaves like the net/http server's
+// http.ResponseWriter, eg changes to the header map after WriteHeader has no effect and trailers are supported.
+//
+// It implements the same optional interfaces as net/http's writer (http.Flusher, http.Hijacker, io.ReaderFrom and
+// the http.ResponseController methods). The features that can't work with a buffered response return
+// http.ErrNotSupported.
+//
+// The methods are safe for concurrent use, once Result has been called writes fail with ErrResponseFinalised. As with
+// net/http the header map must not be used once ServeHTTP has returned.
+type ResponseRecorder struct {
+	mu                sync.Mutex
+	finalised         bool
+	lateWrite         func()
+	lateWriteReported bool
+
+	writeHeaderCalled bool
+
+	// handlerHeader is the Header that Handlers get access to,
+	// which may be retained and mutated even after WriteHeader.
+	// handlerHeader is copied into header at WriteHeader
+	// time. Not strictly necessary but ensures consistency with
+	// http.Response
+	handlerHeader       http.Header
+	handlerHeaderCalled bool
+	header              http.Header
+	body                bytes.Buffer
+	statusCode          int
+}
+
+// Header returns the header map that will be sent by
+// WriteHeader. The Header map also is the mechanism with which
+// Handlers can set HTTP trailers.
+//
+// Changing the header map after a call to WriteHeader (or
+// Write) has no effect.
+func (rw *ResponseRecorder) Header() http.Header {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.handlerHeaderCalled = true
+	return rw.handlerHeader
+}
+
+// we write Status header
+// once WriteHeader is called, further mutations to handlerHeader are ineffective
+
+func (rw *ResponseRecorder) cloneHeader() {
+	h2 := make(http.Header, len(rw.handlerHeader))
+	for k, vv := range rw.handlerHeader {
+		vv2 := make([]string, len(vv))
+		copy(vv2, vv)
+		h2[k] = vv2
+	}
+	rw.header = h2
+}
+
+// Write writes Response data.
+//
+// If WriteHeader has not yet been called, Write calls
+// WriteHeader(http.StatusOK) before writing the data. If the Header
+// does not contain a Content-Type line, Result adds a Content-Type set
+// to the result of passing the initial 512 bytes of written data to
+// DetectContentType.
+func (rw *ResponseRecorder) Write(data []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.finalised {
+		rw.reportLateWrite()
+		return 0, ErrResponseFinalised
+	}
+	if !rw.writeHeaderCalled {
+		rw.writeHeader(http.StatusOK)
+	}
+	if !bodyAllowed(rw.statusCode) {
+		return 0, http.ErrBodyNotAllowed
+	}
+
+	return rw.body.Write(data)
+}
+
+// ReadFrom writes the data read from src, see Write.
+func (rw *ResponseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.finalised {
+		rw.reportLateWrite()
+		return 0, ErrResponseFinalised
+	}
+	if !rw.writeHeaderCalled {
+		rw.writeHeader(http.StatusOK)
+	}
+	if !bodyAllowed(rw.statusCode) {
+		return 0, http.ErrBodyNotAllowed
+	}
+
+	return rw.body.ReadFrom(src)
+}
+
+// WriteHeader sets the Status header with the provided status code.
+// Only one header is set, additional calls are logged & ignored as
+// they are by net/http.
+//
+// Informational (1xx) responses, eg 103 Early Hints, can't be sent
+// to the client before the final response so they're ignored, the
+// headers set for them are sent with the final response. That
+// includes 101 Switching Protocols, lambda can't switch protocols.
+//
+// If WriteHeader is not called explicitly, the first call to Write
+// will trigger an implicit WriteHeader(http.StatusOK).
+// Thus explicit calls to WriteHeader are mainly used to
+// send error codes.
+func (rw *ResponseRecorder) WriteHeader(statusCode int) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.finalised {
+		rw.reportLateWrite()
+		return
+	}
+	rw.writeHeader(statusCode)
+}
+
+func (rw *ResponseRecorder) writeHeader(statusCode int) {
+	if rw.writeHeaderCalled {
+		logSuperfluousWriteHeader()
+		return
+	}
+	if !finalStatus(statusCode) {
+		return
+	}
+	rw.writeHeaderCalled = true
+
+	if rw.handlerHeaderCalled {
+		rw.cloneHeader()
+	}
+
+	rw.statusCode = statusCode
+}
+
+// Flush writes the header if it hasn't been written. The response is buffered until the handler returns, there's
+// nothing else to flush.
+func (rw *ResponseRecorder) Flush() {
+	_ = rw.FlushError()
+}
+
+// FlushError is the same as Flush, it's used by http.ResponseController.
+func (rw *ResponseRecorder) FlushError() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.finalised {
+		rw.reportLateWrite()
+		return ErrResponseFinalised
+	}
+	if !rw.writeHeaderCalled {
+		rw.writeHeader(http.StatusOK)
+	}
+	return nil
+}
+
+// Hijack returns http.ErrNotSupported, there's no connection to take over.
+func (rw *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, http.ErrNotSupported
+}
+
+// SetReadDeadline returns http.ErrNotSupported, the request body has already been read.
+func (rw *ResponseRecorder) SetReadDeadline(deadline time.Time) error {
+	return http.ErrNotSupported
+}
+
+// SetWriteDeadline returns http.ErrNotSupported, the response is sent after the handler returns.
+func (rw *ResponseRecorder) SetWriteDeadline(deadline time.Time) error {
+	return http.ErrNotSupported
+}
+
+// EnableFullDuplex returns http.ErrNotSupported, the response can't be written while the request is being read.
+func (rw *ResponseRecorder) EnableFullDuplex() error {
+	return http.ErrNotSupported
+}
+
+// logSuperfluousWriteHeader logs a call to WriteHeader after the status code was set, as net/http does. It's called by
+// the writer's writeHeader method.
+func logSuperfluousWriteHeader() {
+	caller := "unknown"
+	// the handler calling WriteHeader
+	if _, file, line, ok := runtime.Caller(3); ok {
+		caller = fmt.Sprintf("%s:%d", file, line)
+	}
+	log.Printf("funcserver: superfluous response.WriteHeader call from %s", caller)
+}
+
+// finalStatus reports whether statusCode is the status of the final response, informational (1xx) responses are
+// ignored. It panics if statusCode isn't valid, as net/http does.
+func finalStatus(statusCode int) bool {
+	// net/http allows up to 999 but a function's response must be a valid http status code, see RFC 9110 15
+	// https://github.com/golang/go/blob/go1.22.0/src/net/http/server.go#L1137
+	if statusCode < 100 || statusCode > 599 {
+		panic(fmt.Sprintf("invalid WriteHeader code %v", statusCode))
+	}
+	return statusCode >= 200
+}
+
+// bodyAllowed reports whether a response with the status code may have a body, see RFC 9110 6.4.1.
+func bodyAllowed(status int) bool {
+	if status >= 100 && status <= 199 {
+		return false
+	}
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// Result finalises & returns the recorded response. If nothing has been written, the status is http.StatusOK. If
+// there's a body and no Content-Type header, one is detected from the body.
+func (rw *ResponseRecorder) Result() RecordedResponse {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.finalised = true
+	if !rw.writeHeaderCalled {
+		rw.writeHeader(http.StatusOK)
+	}
+
+	body := rw.body.Bytes()
+	setContentType(rw.header, body)
+
+	rw.mergeTrailers()
+
+	return RecordedResponse{
+		StatusCode: rw.statusCode,
+		Header:     rw.header,
+		Body:       body,
+	}
+}
+
+// setContentType sets the Content-Type header, if there isn't one, to the type detected from the start of the body.
+func setContentType(h http.Header, body []byte) {
+	if len(body) > 0 && h.Get("Content-Type") == "" {
+		max := 512
+		if len(body) < max {
+			max = len(body)
+		}
+		h.Set("Content-Type", http.DetectContentType(body[:max]))
+	}
+}
+
+// reportLateWrite reports the first write after the response was finalised, see Options.LateWriteReporter.
+func (rw *ResponseRecorder) reportLateWrite() {
+	if rw.lateWriteReported {
+		return
+	}
+	rw.lateWriteReported = true
+	if rw.lateWrite != nil {
+		rw.lateWrite()
+		return
+	}
+	log.Print("funcserver: write after the response was finalised")
+}
+
+// mergeTrailers moves the trailers into the header, the whole response is sent at once so there's no need to send
+// them after the body. As with net/http trailers are either declared in the Trailer header before WriteHeader & set
+// afterwards, or set with the http.TrailerPrefix at any time.
+func (rw *ResponseRecorder) mergeTrailers() {
+	for _, v := range rw.header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			k = http.CanonicalHeaderKey(strings.TrimSpace(k))
+			if vv, ok := rw.handlerHeader[k]; ok && k != "" {
+				rw.header[k] = append([]string(nil), vv...)
+			}
+		}
+	}
+	rw.header.Del("Trailer")
+
+	for k := range rw.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			delete(rw.header, k)
+		}
+	}
+	for k, vv := range rw.handlerHeader {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			rw.header[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = append([]string(nil), vv...)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package funcserver
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetPath sets the path of u from p, the path as received by the load balancer or api gateway. It's not decoded, so
+// escapes such as %2F are kept in RawPath as they would be by net/http. Unlike url.Parse, p is always a path, a p of
+// //host/path doesn't set the host.
+func SetPath(u *url.URL, p string) {
+	path, err := url.PathUnescape(p)
+	if err != nil {
+		// not a valid encoding, use as is
+		u.Path = p
+		return
+	}
+	u.Path = path
+	if u.EscapedPath() != p {
+		u.RawPath = p
+		if u.EscapedPath() != p {
+			// p isn't a valid encoding of path, eg it contains a space, use the default encoding
+			u.RawPath = ""
+		}
+	}
+}
+
+// StripPathPrefix removes prefix from p if it's a whole number of path segments, eg an api gateway stage.
+func StripPathPrefix(p, prefix string) string {
+	if p == prefix {
+		return "/"
+	}
+	if strings.HasPrefix(p, prefix+"/") {
+		return p[len(prefix):]
+	}
+	return p
+}
+
+// DecodeBody returns the body of an event, decoded if it's base64 encoded. If it can't be decoded the body is empty &
+// the error is returned, the adapter should still make the request so that a 400 response can be sent, see
+// RequestError.
+func DecodeBody(body string, isBase64Encoded bool) (string, error) {
+	if !isBase64Encoded {
+		return body, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to decode body as base64: %s", body)
+	}
+	return string(decoded), nil
+}
+
+// SetServerFields sets the fields of r that net/http.Server sets from the connection, adapters get them from the event
+// instead: RequestURI from r.URL, the scheme & host of r.URL (r.Host must be set), TLS for https & RemoteAddr. The
+// client's port isn't known, RemoteAddr is ip:0 so that net.SplitHostPort works, it's left empty if ip isn't valid.
+func SetServerFields(r *http.Request, scheme string, ip netip.Addr) {
+	r.RequestURI = r.URL.RequestURI()
+	r.URL.Scheme = scheme
+	r.URL.Host = r.Host
+
+	if scheme == "https" {
+		serverName := strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			serverName = host
+		}
+		r.TLS = &tls.ConnectionState{
+			HandshakeComplete: true,
+			ServerName:        serverName,
+		}
+	}
+
+	if ip.IsValid() {
+		r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+	}
+}
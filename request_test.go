@@ -0,0 +1,68 @@
+package funcserver
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestSetPath(t *testing.T) {
+	for _, tc := range []struct {
+		p           string
+		wantPath    string
+		wantEscaped string
+	}{
+		{"/a/b", "/a/b", "/a/b"},
+		{"/a%2Fb", "/a/b", "/a%2Fb"},
+		{"//evil.com/x", "//evil.com/x", "//evil.com/x"},
+		{"/a b", "/a b", "/a%20b"},
+		{"/a%zzb", "/a%zzb", "/a%25zzb"},
+	} {
+		t.Run(tc.p, func(t *testing.T) {
+			u := &url.URL{}
+			SetPath(u, tc.p)
+			if u.Host != "" {
+				t.Errorf(`u.Host = %q, want: %q`, u.Host, "")
+			}
+			if u.Path != tc.wantPath {
+				t.Errorf(`u.Path = %q, want: %q`, u.Path, tc.wantPath)
+			}
+			if u.EscapedPath() != tc.wantEscaped {
+				t.Errorf(`u.EscapedPath() = %q, want: %q`, u.EscapedPath(), tc.wantEscaped)
+			}
+		})
+	}
+}
+
+func TestStripPathPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		p, prefix string
+		want      string
+	}{
+		{"/prod/products", "/prod", "/products"},
+		{"/prod", "/prod", "/"},
+		{"/production/products", "/prod", "/production/products"},
+		{"/products", "/prod", "/products"},
+	} {
+		if got := StripPathPrefix(tc.p, tc.prefix); got != tc.want {
+			t.Errorf(`StripPathPrefix(%q, %q) = %q, want: %q`, tc.p, tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	for _, tc := range []struct {
+		body     string
+		isBase64 bool
+		want     string
+		wantErr  bool
+	}{
+		{"body", false, "body", false},
+		{"Ym9keQ==", true, "body", false},
+		{"not base64", true, "", true},
+	} {
+		got, err := DecodeBody(tc.body, tc.isBase64)
+		if got != tc.want || (err != nil) != tc.wantErr {
+			t.Errorf(`DecodeBody(%q, %t) = %q, %v, want: %q, error %t`, tc.body, tc.isBase64, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package funcserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// streamBufferSize is the amount of body buffered before the response is committed and the buffer written to the
+// stream, a call to Flush commits the response immediately.
+const streamBufferSize = 4096
+
+// StreamingAdapter converts a provider's events to requests for a handler whose response is streamed rather than
+// recorded. The status code & headers are sent before the body in a prelude, encoded by the adapter.
+type StreamingAdapter[Req any] interface {
+	// DecodeRequest converts an incoming event into a *http.Request.
+	DecodeRequest(ctx context.Context, event Req) (*http.Request, error)
+
+	// EncodePrelude returns what's written to the stream before the body of the response to req, it's called when
+	// the response is committed.
+	EncodePrelude(req *http.Request, statusCode int, header http.Header) ([]byte, error)
+}
+
+// WrapStreaming returns a StreamingHandler that uses a to convert events to requests for h and streams the response
+// as h writes it. Body writes are buffered until 4kb has been written or h calls Flush (the http.ResponseWriter
+// implements http.Flusher), that commits the response, after that each write is sent straight away.
+//
+// Of the Options, RecoverPanics, PanicHandler, PanicReporter, RespondToBadRequests, ErrorHandler & OnColdStart apply
+// as they do to WrapWithOptions, except that a panic after the response was committed can't be answered by
+// PanicHandler, the invocation fails with the panic instead. TimeoutMargin, TimeoutHandler & LateWriteReporter are
+// ignored as a streamed response can't be replaced once it's started, MaxConcurrency is ignored too.
+func WrapStreaming[Req any](a StreamingAdapter[Req], h http.Handler, opts Options) StreamingHandler[Req] {
+	iv := &invoker{opts: opts}
+
+	return func(ctx context.Context, event Req, w io.Writer) (err error) {
+		ctx = iv.start(ctx)
+
+		req, badRequest, err := iv.request(a.DecodeRequest(ctx, event))
+		if err != nil {
+			return err
+		}
+		if badRequest != nil {
+			return stream(a, req, badRequest, w)
+		}
+
+		sw := newStreamWriter(a, req, w)
+
+		defer func() {
+			if r := recover(); r != nil {
+				err = iv.recovered(req, r)
+				// once the prelude has been sent the response can't be replaced
+				if opts.RecoverPanics && !sw.committed {
+					err = stream(a, req, iv.panicHandler(), w)
+				}
+			}
+		}()
+
+		h.ServeHTTP(sw, req)
+
+		return sw.finish()
+	}
+}
+
+// stream streams the response of h to req.
+func stream[Req any](a StreamingAdapter[Req], req *http.Request, h http.Handler, w io.Writer) error {
+	sw := newStreamWriter(a, req, w)
+	h.ServeHTTP(sw, req)
+	return sw.finish()
+}
+
+func newStreamWriter[Req any](a StreamingAdapter[Req], req *http.Request, w io.Writer) *streamWriter {
+	return &streamWriter{
+		w: w,
+		encodePrelude: func(statusCode int, header http.Header) ([]byte, error) {
+			return a.EncodePrelude(req, statusCode, header)
+		},
+		handlerHeader: make(http.Header),
+	}
+}
+
+var _ http.Flusher = &streamWriter{}
+
+// streamWriter writes the response to w as it's written by a handler. Once the prelude has been written (the
+// response is committed) changes to the header map have no effect.
+type streamWriter struct {
+	w                 io.Writer
+	encodePrelude     func(statusCode int, header http.Header) ([]byte, error)
+	handlerHeader     http.Header
+	writeHeaderCalled bool
+	statusCode        int
+	committed         bool
+	buf               []byte
+	err               error
+}
+
+// Header returns the header map that will be sent in the prelude.
+func (sw *streamWriter) Header() http.Header {
+	return sw.handlerHeader
+}
+
+// WriteHeader sets the status code, the response isn't committed until the body is flushed. As with
+// ResponseRecorder informational (1xx) responses, including 101 Switching Protocols, are ignored.
+func (sw *streamWriter) WriteHeader(statusCode int) {
+	sw.writeHeader(statusCode)
+}
+
+func (sw *streamWriter) writeHeader(statusCode int) {
+	if sw.writeHeaderCalled {
+		logSuperfluousWriteHeader()
+		return
+	}
+	if !finalStatus(statusCode) {
+		return
+	}
+	sw.writeHeaderCalled = true
+
+	sw.statusCode = statusCode
+}
+
+// Write writes body data, it's buffered until the response is committed.
+func (sw *streamWriter) Write(data []byte) (int, error) {
+	if !sw.writeHeaderCalled {
+		sw.writeHeader(http.StatusOK)
+	}
+	if sw.err != nil {
+		return 0, sw.err
+	}
+
+	if !sw.committed {
+		sw.buf = append(sw.buf, data...)
+		if len(sw.buf) >= streamBufferSize {
+			sw.Flush()
+		}
+		return len(data), sw.err
+	}
+
+	n, err := sw.w.Write(data)
+	sw.err = err
+	return n, err
+}
+
+// Flush commits the response if needed and sends any buffered data.
+func (sw *streamWriter) Flush() {
+	_ = sw.FlushError()
+}
+
+// FlushError is the same as Flush but returns the error writing to the stream, it's used by
+// http.ResponseController.
+func (sw *streamWriter) FlushError() error {
+	if !sw.writeHeaderCalled {
+		sw.writeHeader(http.StatusOK)
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+
+	var out []byte
+	if !sw.committed {
+		sw.committed = true
+		setContentType(sw.handlerHeader, sw.buf)
+		out, sw.err = sw.encodePrelude(sw.statusCode, sw.handlerHeader)
+		if sw.err != nil {
+			return sw.err
+		}
+	}
+	out = append(out, sw.buf...)
+	sw.buf = nil
+
+	if len(out) > 0 {
+		_, sw.err = sw.w.Write(out)
+	}
+	return sw.err
+}
+
+// finish commits the response if the handler didn't write anything and sends what's left in the buffer.
+func (sw *streamWriter) finish() error {
+	sw.Flush()
+	return sw.err
+}
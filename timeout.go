@@ -0,0 +1,128 @@
+package funcserver
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// serveWithTimeout serves req with h recording the response in rec, as http.TimeoutHandler does, but with a deadline
+// rather than a duration. If h hasn't returned by the deadline the request's context is cancelled, timedOut is true &
+// rec must not be used, writes h makes after that fail with http.ErrHandlerTimeout. A panic in h is raised again in
+// the calling goroutine, or passed to reportPanic if it's after the timeout. done is called when h returns, which can
+// be after serveWithTimeout has timed out.
+func serveWithTimeout(h http.Handler, rec *ResponseRecorder, req *http.Request, deadline time.Time, done func(), reportPanic func(p handlerPanic)) (timedOut bool) {
+	ctx, cancel := context.WithDeadline(req.Context(), deadline)
+	defer cancel()
+
+	tw := &timeoutWriter{rec: rec}
+	returned := make(chan struct{})
+	panicChan := make(chan handlerPanic, 1)
+	go func() {
+		defer done()
+		defer func() {
+			if r := recover(); r != nil {
+				p := handlerPanic{value: r, stack: debug.Stack()}
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				if tw.timedOut {
+					// nothing is waiting for it
+					reportPanic(p)
+					return
+				}
+				panicChan <- p
+			}
+		}()
+		h.ServeHTTP(tw, req.WithContext(ctx))
+		close(returned)
+	}()
+
+	select {
+	case p := <-panicChan:
+		panic(p)
+	case <-returned:
+		return false
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		// h may have finished as the deadline passed, its response is used rather than timing out
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case <-returned:
+			return false
+		default:
+		}
+		tw.timedOut = true
+		return true
+	}
+}
+
+// handlerPanic is a panic in a handler running in another goroutine, it keeps the stack trace of that goroutine.
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+// timeoutWriter is the http.ResponseWriter of a handler served by serveWithTimeout, it stops writes reaching rec once
+// the handler has timed out.
+type timeoutWriter struct {
+	rec *ResponseRecorder
+
+	mu       sync.Mutex
+	timedOut bool
+}
+
+// Header returns the header map of the response, it's not used once the handler has timed out.
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.rec.Header()
+}
+
+// Write writes response data, after the handler has timed out it returns http.ErrHandlerTimeout.
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.rec.Write(data)
+}
+
+// WriteHeader sets the status code, it's ignored after the handler has timed out.
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.rec.WriteHeader(statusCode)
+}
+
+// FlushError writes the header if it hasn't been written, see ResponseRecorder.Flush. After the handler has timed
+// out it returns http.ErrHandlerTimeout.
+func (tw *timeoutWriter) FlushError() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	return tw.rec.FlushError()
+}
+
+// Flush is the same as FlushError without the error.
+func (tw *timeoutWriter) Flush() {
+	_ = tw.FlushError()
+}
+
+// timeoutResponse returns the response to req, whose handler timed out, written by opts.TimeoutHandler.
+func timeoutResponse[Req, Resp any](a Adapter[Req, Resp], req *http.Request, opts Options) (Resp, error) {
+	h := opts.TimeoutHandler
+	if h == nil {
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		})
+	}
+	return respond(a, req, h)
+}
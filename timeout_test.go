@@ -0,0 +1,105 @@
+package funcserver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	opts := Options{TimeoutMargin: 50 * time.Millisecond}
+
+	t.Run("in time", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte("ok"))
+		}), opts)
+
+		resp, err := h(ctx, testEvent{Path: "/a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "text/plain; charset=utf-8 ok" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 ok")
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		responded, lateWrite := make(chan struct{}), make(chan error)
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte("partial"))
+			<-req.Context().Done()
+			<-responded
+			_, err := res.Write([]byte("late"))
+			lateWrite <- err
+		}), opts)
+
+		resp, err := h(ctx, testEvent{Path: "/a"})
+		close(responded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ctx.Err() != nil {
+			t.Errorf(`ctx.Err() = %v, want: response before the deadline`, ctx.Err())
+		}
+		if resp.Body != "text/plain; charset=utf-8 Service Unavailable\n" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 Service Unavailable\n")
+		}
+		if err := <-lateWrite; err != http.ErrHandlerTimeout {
+			t.Errorf(`late Write() = %v, want: %v`, err, http.ErrHandlerTimeout)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var stack []byte
+		opts := opts
+		opts.PanicReporter = func(req *http.Request, err error, s []byte) { stack = s }
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			panic("oops")
+		}), opts)
+
+		if _, err := h(ctx, testEvent{Path: "/a"}); err == nil || err.Error() != "oops" {
+			t.Errorf(`err = %v, want: %q`, err, "oops")
+		}
+		if !bytes.Contains(stack, []byte("timeout_test.go")) {
+			t.Errorf(`stack = %s, want: the handler's stack`, stack)
+		}
+	})
+
+	t.Run("panic after the timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		responded, reported := make(chan struct{}), make(chan error)
+		opts := opts
+		opts.PanicReporter = func(req *http.Request, err error, s []byte) { reported <- err }
+		h := WrapWithOptions[testEvent, testResponse](testAdapter{}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			<-req.Context().Done()
+			<-responded
+			panic("late oops")
+		}), opts)
+
+		resp, err := h(ctx, testEvent{Path: "/a"})
+		close(responded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Body != "text/plain; charset=utf-8 Service Unavailable\n" {
+			t.Errorf(`resp.Body = %q, want: %q`, resp.Body, "text/plain; charset=utf-8 Service Unavailable\n")
+		}
+		select {
+		case err := <-reported:
+			if err.Error() != "late oops" {
+				t.Errorf(`err = %v, want: %q`, err, "late oops")
+			}
+		case <-time.After(time.Second):
+			t.Error("panic after the timeout wasn't reported")
+		}
+	})
+}